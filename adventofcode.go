@@ -1,20 +1,33 @@
 package adventofcode
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"unicode/utf8"
 )
 
 func LoadInput(p Puzzle) (Input, error) {
-	path := fmt.Sprintf("inputs/d%02d.txt", p.Details().Day)
-	if bytes, err := os.ReadFile(path); err != nil {
+	if bytes, err := os.ReadFile(inputPath(p)); err != nil {
 		return "", err
 	} else {
-		return Input(bytes[:]), nil
+		return NewInput(string(bytes[:])), nil
 	}
 }
 
+// OpenInput opens the input file of the puzzle to be streamed into a
+// StreamSolver, which is preferable to LoadInput for large (e.g. generated)
+// inputs. The caller is responsible for closing the file.
+func OpenInput(p Puzzle) (*os.File, error) {
+	return os.Open(inputPath(p))
+}
+
+func inputPath(p Puzzle) string {
+	return fmt.Sprintf("inputs/d%02d.txt", p.Details().Day)
+}
+
 type Details struct {
 	Day         int
 	Description string
@@ -26,8 +39,243 @@ func (d Details) String() string {
 
 type Input string
 
+const byteOrderMark = "\uFEFF"
+
+// NewInput creates an Input from the given text after stripping the UTF-8
+// byte order mark, converting Windows line endings (CRLF) into LF and
+// removing trailing newlines.
+func NewInput(text string) Input {
+	return Input(normalize(text))
+}
+
+func normalize(text string) string {
+	text = strings.TrimPrefix(text, byteOrderMark)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.TrimRight(text, "\n")
+}
+
+// Text returns the input normalized as in NewInput.
+func (i Input) Text() string {
+	return normalize(string(i))
+}
+
+// Lines returns the lines of the normalized input, so a trailing newline
+// doesn't produce an empty last line.
 func (i Input) Lines() []string {
-	return strings.Split(string(i), "\n")
+	return strings.Split(i.Text(), "\n")
+}
+
+// Reader returns a reader over the input as is, which the iterators
+// normalize.
+func (i Input) Reader() io.Reader {
+	return strings.NewReader(string(i))
+}
+
+// LineIterator returns an iterator over the lines of the input.
+func (i Input) LineIterator() *Iterator {
+	return NewLineIterator(i.Reader())
+}
+
+// ParagraphIterator returns an iterator over the groups of lines of the
+// input that are separated by one or more blank (or whitespace only) lines.
+func (i Input) ParagraphIterator() *Iterator {
+	return NewParagraphIterator(i.Reader())
+}
+
+// RecordIterator returns an iterator over groups of n consecutive lines.
+func (i Input) RecordIterator(n int) *Iterator {
+	return NewRecordIterator(i.Reader(), n)
+}
+
+// maxLineLength is the longest line an Iterator is able to read.
+const maxLineLength = 16 * 1024 * 1024
+
+// Iterator reads records made of one or more lines from an io.Reader,
+// holding in memory only the record being currently iterated over. Lines are
+// normalized as in NewInput: the byte order mark, carriage returns preceding
+// line feeds and blank lines at the end of the input are discarded. Its
+// usage mirrors bufio.Scanner:
+//
+//	it := input.LineIterator()
+//	for it.Next() {
+//		line := it.Text()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	scanner *bufio.Scanner
+	size    int // number of lines per record; 0 means records are separated by blank lines
+	record  []string
+	line    int // number of the first line of the current record (1-based)
+	read    int // number of lines read so far
+	started bool
+	blanks  int     // number of blank lines read ahead that are yet to be returned
+	held    *string // non-blank line read ahead that is yet to be returned
+	err     error
+}
+
+func NewLineIterator(r io.Reader) *Iterator {
+	return newIterator(r, 1)
+}
+
+func NewParagraphIterator(r io.Reader) *Iterator {
+	return newIterator(r, 0)
+}
+
+func NewRecordIterator(r io.Reader, n int) *Iterator {
+	it := newIterator(r, n)
+	if n <= 0 {
+		it.err = fmt.Errorf("invalid record size: %d", n)
+	}
+	return it
+}
+
+func newIterator(r io.Reader, size int) *Iterator {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineLength)
+	return &Iterator{scanner: scanner, size: size}
+}
+
+// Next advances the iterator to the next record, returning false when there
+// are no more records or an error occurred.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.record = it.record[:0]
+	it.line = 0
+
+	for it.size == 0 || len(it.record) < it.size {
+		text, ok := it.nextLine()
+		if !ok {
+			it.err = it.scanner.Err()
+			break
+		}
+		it.read++
+		if it.size == 0 && strings.TrimSpace(text) == "" {
+			if len(it.record) == 0 {
+				continue // consecutive blank lines
+			}
+			break
+		}
+		if len(it.record) == 0 {
+			it.line = it.read
+		}
+		it.record = append(it.record, text)
+	}
+
+	if it.err == nil && it.size > 0 && len(it.record) > 0 && len(it.record) < it.size {
+		it.err = fmt.Errorf("incomplete record starting on line %d: expected %d lines, got %d", it.line, it.size, len(it.record))
+		return false
+	}
+	return it.err == nil && len(it.record) > 0
+}
+
+// nextLine returns the next line of the input, discarding blank lines that
+// aren't followed by a non-blank one.
+func (it *Iterator) nextLine() (string, bool) {
+	if it.blanks > 0 {
+		it.blanks--
+		return "", true
+	}
+	if it.held != nil {
+		text := *it.held
+		it.held = nil
+		return text, true
+	}
+
+	blanks := 0
+	for it.scanner.Scan() {
+		text := it.scanner.Text()
+		if !it.started {
+			text = strings.TrimPrefix(text, byteOrderMark)
+			it.started = true
+		}
+		if text == "" {
+			blanks++
+			continue
+		}
+		if blanks > 0 {
+			it.blanks = blanks - 1
+			it.held = &text
+			return "", true
+		}
+		return text, true
+	}
+	return "", false
+}
+
+// Record returns the lines of the current record. The returned slice may be
+// overwritten by the next call to Next.
+func (it *Iterator) Record() []string {
+	return it.record
+}
+
+// Text returns the lines of the current record joined by newlines.
+func (it *Iterator) Text() string {
+	return strings.Join(it.record, "\n")
+}
+
+// Line returns the number (1-based) of the first line of the current record.
+func (it *Iterator) Line() int {
+	return it.line
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// ParseError reports a puzzle input that doesn't conform to the expected
+// format, pointing at the offending line and (when known) column.
+type ParseError struct {
+	Day      int
+	Line     int    // 1-based
+	Column   int    // 1-based, counted in runes; 0 if the whole line is invalid
+	Text     string // content of the offending line
+	Expected string // description of the expected content
+}
+
+func (e *ParseError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("day %d, line %d, column %d: expected %s", e.Day, e.Line, e.Column, e.Expected)
+	}
+	return fmt.Sprintf("day %d, line %d: expected %s", e.Day, e.Line, e.Expected)
+}
+
+// Excerpt returns the offending line followed by a line with a caret under
+// the offending column (or under the first character if the column is
+// unknown).
+func (e *ParseError) Excerpt() string {
+	var b strings.Builder
+	b.WriteString(e.Text)
+	b.WriteByte('\n')
+	col := 1
+	for _, r := range e.Text {
+		if col >= e.Column {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t') // keeps the caret aligned with tab-indented lines
+		} else {
+			b.WriteRune(' ')
+		}
+		col++
+	}
+	for ; col < e.Column; col++ { // column is past the end of the line
+		b.WriteRune(' ')
+	}
+	b.WriteRune('^')
+	return b.String()
+}
+
+// column returns the 1-based rune column of the given byte offset in text.
+func column(text string, offset int) int {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	return utf8.RuneCountInString(text[:offset]) + 1
 }
 
 type Result struct {
@@ -38,3 +286,16 @@ type Puzzle interface {
 	Details() Details
 	Solve(*Input) (Result, error)
 }
+
+// Renderer is implemented by puzzles that can draw a visual representation
+// of their input.
+type Renderer interface {
+	Render(*Input, io.Writer) error
+}
+
+// StreamSolver is implemented by puzzles that can be solved reading their
+// input once through an Iterator, so it's never held in memory as a whole
+// (see OpenInput).
+type StreamSolver interface {
+	SolveStream(io.Reader) (Result, error)
+}
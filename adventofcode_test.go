@@ -1,134 +1,1053 @@
 package adventofcode
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/google/go-cmp/cmp"
 )
 
+var solutionTests = []struct {
+	puzzle Puzzle
+	want   Result
+}{
+	{
+		puzzle: CalorieCounting{},
+		want:   Result{Part1: "72511", Part2: "212117"},
+	},
+	{
+		puzzle: RockPaperScissors{},
+		want:   Result{Part1: "12679", Part2: "14470"},
+	},
+	{
+		puzzle: RucksackReorganization{},
+		want:   Result{Part1: "7737", Part2: "2697"},
+	},
+	{
+		puzzle: CampCleanup{},
+		want:   Result{Part1: "475", Part2: "825"},
+	},
+	{
+		puzzle: SupplyStacks{},
+		want:   Result{Part1: "TLFGBZHCN", Part2: "QRQFHFWCL"},
+	},
+	{
+		puzzle: TuningTrouble{},
+		want:   Result{Part1: "1142", Part2: "2803"},
+	},
+	{
+		puzzle: NoSpaceLeftOnDevice{},
+		want:   Result{Part1: "1443806", Part2: "942298"},
+	},
+	{
+		puzzle: TreetopTreeHouse{},
+		want:   Result{Part1: "1700", Part2: "470596"},
+	},
+	{
+		puzzle: RopeBridge{},
+		want:   Result{Part1: "6498", Part2: "2531"},
+	},
+	{
+		puzzle: CathodeRayTube{},
+		want: Result{
+			Part1: "13680",
+			Part2: `###..####..##..###..#..#.###..####.###..
+#..#....#.#..#.#..#.#.#..#..#.#....#..#.
+#..#...#..#....#..#.##...#..#.###..###..
+###...#...#.##.###..#.#..###..#....#..#.
+#....#....#..#.#....#.#..#....#....#..#.
+#....####..###.#....#..#.#....####.###..`,
+		},
+	},
+	{
+		puzzle: MonkeyInTheMiddle{},
+		want:   Result{Part1: "98280", Part2: "17673687232"},
+	},
+	{
+		puzzle: HillClimbingAlgorithm{},
+		want:   Result{Part1: "423", Part2: "416"},
+	},
+	{
+		puzzle: DistressSignal{},
+		want:   Result{Part1: "5843", Part2: "26289"},
+	},
+	{
+		puzzle: RegolithReservoir{},
+		want:   Result{Part1: "655", Part2: "26484"},
+	},
+	{
+		puzzle: BeaconExclusionZone{},
+		want:   Result{Part1: "5144286", Part2: "10229191267339"},
+	},
+	{
+		puzzle: ProboscideaVolcanium{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: PyroclasticFlow{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: BoilingBoulders{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: NotEnoughMinerals{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: GrovePositioningSystem{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: MonkeyMath{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: MonkeyMap{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: UnstableDiffusion{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: BlizzardBasin{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+	{
+		puzzle: FullOfHotAir{},
+		want:   Result{Part1: "?", Part2: "?"},
+	},
+}
+
 func TestSolutions(t *testing.T) {
+	for _, tc := range solutionTests {
+		t.Run(tc.puzzle.Details().String(), func(t *testing.T) {
+			input, err := LoadInput(tc.puzzle)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := tc.puzzle.Solve(&input)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStreamSolutions(t *testing.T) {
+	for _, tc := range solutionTests {
+		s, ok := tc.puzzle.(StreamSolver)
+		if !ok {
+			continue
+		}
+		t.Run(tc.puzzle.Details().String(), func(t *testing.T) {
+			f, err := OpenInput(tc.puzzle)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer f.Close()
+			got, err := s.SolveStream(iotest.OneByteReader(f))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSolutionsWithInputVariants(t *testing.T) {
+	variants := map[string]func(string) string{
+		"no trailing newline": func(s string) string { return s },
+		"trailing newline":    func(s string) string { return s + "\n" },
+		"CRLF": func(s string) string {
+			return strings.ReplaceAll(s, "\n", "\r\n") + "\r\n"
+		},
+		"BOM and CRLF": func(s string) string {
+			return "\uFEFF" + strings.ReplaceAll(s, "\n", "\r\n") + "\r\n\r\n"
+		},
+	}
+
+	for _, tc := range solutionTests {
+		if tc.want.Part1 == "?" {
+			continue // not solved yet
+		}
+		raw, err := os.ReadFile(inputPath(tc.puzzle))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		text := strings.TrimRight(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+
+		for name, variant := range variants {
+			t.Run(fmt.Sprintf("%s/%s", tc.puzzle.Details(), name), func(t *testing.T) {
+				input := Input(variant(text))
+				got, err := tc.puzzle.Solve(&input)
+
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if diff := cmp.Diff(tc.want, got); diff != "" {
+					t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestInputIterators(t *testing.T) {
+	input := Input("a\nb\n\n\nc\nd\ne\n\nf")
 	tests := []struct {
-		puzzle Puzzle
-		want   Result
+		name      string
+		iterator  *Iterator
+		want      [][]string
+		wantLines []int
+		wantErr   bool
 	}{
 		{
-			puzzle: CalorieCounting{},
-			want:   Result{Part1: "72511", Part2: "212117"},
+			name:      "lines",
+			iterator:  input.LineIterator(),
+			want:      [][]string{{"a"}, {"b"}, {""}, {""}, {"c"}, {"d"}, {"e"}, {""}, {"f"}},
+			wantLines: []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:      "paragraphs",
+			iterator:  input.ParagraphIterator(),
+			want:      [][]string{{"a", "b"}, {"c", "d", "e"}, {"f"}},
+			wantLines: []int{1, 5, 9},
 		},
 		{
-			puzzle: RockPaperScissors{},
-			want:   Result{Part1: "12679", Part2: "14470"},
+			name:      "records",
+			iterator:  input.RecordIterator(3),
+			want:      [][]string{{"a", "b", ""}, {"", "c", "d"}, {"e", "", "f"}},
+			wantLines: []int{1, 4, 7},
 		},
 		{
-			puzzle: RucksackReorganization{},
-			want:   Result{Part1: "7737", Part2: "2697"},
+			name:      "normalized lines",
+			iterator:  Input("\uFEFFa\r\n\r\nb\r\n\r\n\r\n").LineIterator(),
+			want:      [][]string{{"a"}, {""}, {"b"}},
+			wantLines: []int{1, 2, 3},
 		},
 		{
-			puzzle: CampCleanup{},
-			want:   Result{Part1: "475", Part2: "825"},
+			name:      "incomplete record",
+			iterator:  input.RecordIterator(4),
+			want:      [][]string{{"a", "b", "", ""}, {"c", "d", "e", ""}},
+			wantLines: []int{1, 5},
+			wantErr:   true,
 		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got [][]string
+			var gotLines []int
+			for tc.iterator.Next() {
+				got = append(got, append([]string{}, tc.iterator.Record()...))
+				gotLines = append(gotLines, tc.iterator.Line())
+			}
+
+			if err := tc.iterator.Err(); (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantLines, gotLines); diff != "" {
+				t.Fatalf("unexpected line numbers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		puzzle      Puzzle
+		input       Input
+		want        ParseError
+		wantExcerpt string
+	}{
 		{
-			puzzle: SupplyStacks{},
-			want:   Result{Part1: "TLFGBZHCN", Part2: "QRQFHFWCL"},
+			name:        "invalid calories",
+			puzzle:      CalorieCounting{},
+			input:       "1000\n2000\n\n3x00",
+			want:        ParseError{Day: 1, Line: 4, Text: "3x00", Expected: "a number of calories"},
+			wantExcerpt: "3x00\n^",
 		},
 		{
-			puzzle: TuningTrouble{},
-			want:   Result{Part1: "1142", Part2: "2803"},
+			name:        "invalid rucksack item",
+			puzzle:      RucksackReorganization{},
+			input:       "vJrwpWtwJgWrhcsFMMfFFhFp\njqHRNqRjqzjGDLG?LrsFMfFZSrLrFZsSL",
+			want:        ParseError{Day: 3, Line: 2, Column: 16, Text: "jqHRNqRjqzjGDLG?LrsFMfFZSrLrFZsSL", Expected: "an item (a-z or A-Z)"},
+			wantExcerpt: "jqHRNqRjqzjGDLG?LrsFMfFZSrLrFZsSL\n               ^",
 		},
 		{
-			puzzle: NoSpaceLeftOnDevice{},
-			want:   Result{Part1: "1443806", Part2: "942298"},
+			name:   "invalid monkey item",
+			puzzle: MonkeyInTheMiddle{},
+			input: `Monkey 0:
+  Starting items: 79, x8
+  Operation: new = old * 19
+  Test: divisible by 23
+    If true: throw to monkey 2
+    If false: throw to monkey 3`,
+			want:        ParseError{Day: 11, Line: 2, Column: 23, Text: "  Starting items: 79, x8", Expected: "a worry level"},
+			wantExcerpt: "  Starting items: 79, x8\n                      ^",
 		},
 		{
-			puzzle: TreetopTreeHouse{},
-			want:   Result{Part1: "1700", Part2: "470596"},
+			name:        "unbalanced packet",
+			puzzle:      DistressSignal{},
+			input:       "[1,[2]\n[3]",
+			want:        ParseError{Day: 13, Line: 1, Column: 7, Text: "[1,[2]", Expected: "']'"},
+			wantExcerpt: "[1,[2]\n      ^",
 		},
 		{
-			puzzle: RopeBridge{},
-			want:   Result{Part1: "6498", Part2: "2531"},
+			name:        "indented packet",
+			puzzle:      DistressSignal{},
+			input:       "[1]\n\t  [1,x]",
+			want:        ParseError{Day: 13, Line: 2, Column: 7, Text: "\t  [1,x]", Expected: "a digit, ',', '[' or ']'"},
+			wantExcerpt: "\t  [1,x]\n\t     ^",
 		},
 		{
-			puzzle: CathodeRayTube{},
-			want: Result{
-				Part1: "13680",
-				Part2: `###..####..##..###..#..#.###..####.###..
-#..#....#.#..#.#..#.#.#..#..#.#....#..#.
-#..#...#..#....#..#.##...#..#.###..###..
-###...#...#.##.###..#.#..###..#....#..#.
-#....#....#..#.#....#.#..#....#....#..#.
-#....####..###.#....#..#.#....####.###..`,
-			},
+			name:        "diagonal rock path",
+			puzzle:      RegolithReservoir{},
+			input:       "498,4 -> 498,6 -> 496,6\n503,4 -> 502,5",
+			want:        ParseError{Day: 14, Line: 2, Column: 10, Text: "503,4 -> 502,5", Expected: "a point horizontally or vertically aligned with the previous one"},
+			wantExcerpt: "503,4 -> 502,5\n         ^",
 		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.puzzle.Solve(&tc.input)
+
+			var got *ParseError
+			if !errors.As(err, &got) {
+				t.Fatalf("expected a ParseError, got: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, *got); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantExcerpt, got.Excerpt()); diff != "" {
+				t.Fatalf("unexpected excerpt (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+const monkeyNotesExample = `Monkey 0:
+  Starting items: 79, 98
+  Operation: new = old * 19
+  Test: divisible by 23
+    If true: throw to monkey 2
+    If false: throw to monkey 3
+
+Monkey 1:
+  Starting items: 54, 65, 75, 74
+  Operation: new = old + 6
+  Test: divisible by 19
+    If true: throw to monkey 2
+    If false: throw to monkey 0
+
+Monkey 2:
+  Starting items: 79, 60, 97
+  Operation: new = old * old
+  Test: divisible by 13
+    If true: throw to monkey 1
+    If false: throw to monkey 3
+
+Monkey 3:
+  Starting items: 74
+  Operation: new = old + 3
+  Test: divisible by 17
+    If true: throw to monkey 0
+    If false: throw to monkey 1`
+
+func TestMonkeyNotesParsing(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   Input
+		want    Result
+		wantErr *ParseError
+	}{
 		{
-			puzzle: MonkeyInTheMiddle{},
-			want:   Result{Part1: "98280", Part2: "17673687232"},
+			name:  "puzzle example",
+			input: monkeyNotesExample,
+			want:  Result{Part1: "10605", Part2: "2713310158"},
 		},
 		{
-			puzzle: HillClimbingAlgorithm{},
-			want:   Result{Part1: "423", Part2: "416"},
+			name: "extra whitespace and swapped actions",
+			input: Input(strings.NewReplacer(
+				"Monkey 0:", "Monkey  0 :",
+				"79, 98", " 79 ,98 ",
+				"new = old * 19", "new=old*19",
+				"    If true: throw to monkey 2\n    If false: throw to monkey 3", "\tIf false:  throw to monkey 3\n\tIf true: throw to monkey 2  ",
+				"\n\nMonkey 1", "\n  \t\n\nMonkey 1",
+			).Replace(monkeyNotesExample)),
+			want: Result{Part1: "10605", Part2: "2713310158"},
 		},
 		{
-			puzzle: DistressSignal{},
-			want:   Result{Part1: "5843", Part2: "26289"},
+			name:    "truncated notes",
+			input:   "Monkey 0:\n  Starting items: 79, 98\n  Operation: new = old * 19",
+			wantErr: &ParseError{Day: 11, Line: 4, Expected: "a 'Test' note"},
 		},
 		{
-			puzzle: RegolithReservoir{},
-			want:   Result{Part1: "655", Part2: "26484"},
+			name:    "notes out of order",
+			input:   "Monkey 0:\n  Operation: new = old * 19\n  Starting items: 79, 98",
+			wantErr: &ParseError{Day: 11, Line: 3, Text: "  Starting items: 79, 98", Expected: "'Starting items' note before 'Operation'"},
 		},
 		{
-			puzzle: BeaconExclusionZone{},
-			want:   Result{Part1: "5144286", Part2: "10229191267339"},
+			name:    "zero divisor",
+			input:   Input(strings.Replace(monkeyNotesExample, "divisible by 19", "divisible by 0", 1)),
+			wantErr: &ParseError{Day: 11, Line: 11, Column: 22, Text: "  Test: divisible by 0", Expected: "a positive divisor"},
 		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := MonkeyInTheMiddle{}.Solve(&tc.input)
+
+			if tc.wantErr != nil {
+				var gotErr *ParseError
+				if !errors.As(err, &gotErr) {
+					t.Fatalf("expected a ParseError, got: %v", err)
+				}
+				if diff := cmp.Diff(tc.wantErr, gotErr); diff != "" {
+					t.Fatalf("unexpected error diff (-want +got):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func FuzzMonkeyNotesParsing(f *testing.F) {
+	f.Add(monkeyNotesExample)
+	f.Add("Monkey 0:\n  Starting items: 79, 98")
+	f.Add("Monkey 0:\n  Starting items:\n  Operation: new = 1 + 2\n  Test: divisible by 99999999999999999999")
+
+	f.Fuzz(func(t *testing.T, notes string) {
+		input := Input(notes)
+		_, err := MonkeyInTheMiddle{}.parseNotes(&input)
+
+		var perr *ParseError
+		if err != nil && !errors.As(err, &perr) {
+			t.Fatalf("expected a ParseError, got: %v", err)
+		}
+	})
+}
+
+func TestMonkeyOperationExpressions(t *testing.T) {
+	tests := []struct {
+		expr        string
+		old         WorryLevel
+		want        WorryLevel
+		wantModular bool
+		wantErrPos  int
+		wantErr     string
+	}{
+		{expr: "old * 19", old: 79, want: 1501, wantModular: true},
+		{expr: "old*old", old: 79, want: 6241, wantModular: true},
+		{expr: "1 + 2 * old - 3", old: 5, want: 8, wantModular: true},
+		{expr: "(1 + 2) * (old - 3)", old: 5, want: 6, wantModular: true},
+		{expr: "old - 10 - 1", old: 5, want: -6, wantModular: true},
+		{expr: "old / 2 + old % 3", old: 11, want: 7, wantModular: false},
+		{expr: " ( ( old ) ) ", old: 4, want: 4, wantModular: true},
+		{expr: "old +", wantErrPos: 5, wantErr: "a number, 'old' or '('"},
+		{expr: "(old + 1", wantErrPos: 8, wantErr: "')'"},
+		{expr: "old ^ 2", wantErrPos: 4, wantErr: "an operator"},
+		{expr: "99999999999999999999", wantErrPos: 0, wantErr: "a number that fits in an int"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			expr, pos, expected := parseOpExpr(tc.expr)
+
+			if tc.wantErr != "" {
+				if expr != nil || pos != tc.wantErrPos || expected != tc.wantErr {
+					t.Fatalf("want error %q at %d, got %q at %d", tc.wantErr, tc.wantErrPos, expected, pos)
+				}
+				return
+			}
+			if expr == nil {
+				t.Fatalf("unexpected error at %d: expected %s", pos, expected)
+			}
+			got, err := expr.eval(tc.old)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("want %d, got %d", tc.want, got)
+			}
+			if expr.modular() != tc.wantModular {
+				t.Fatalf("want modular %v, got %v", tc.wantModular, expr.modular())
+			}
+		})
+	}
+}
+
+func TestMonkeyOperationIncompatibleWithModularReduction(t *testing.T) {
+	input := Input(strings.Replace(monkeyNotesExample, "new = old + 6", "new = old / 2 + 6", 1))
+
+	_, err := MonkeyInTheMiddle{}.Solve(&input)
+
+	if err == nil || !strings.Contains(err.Error(), "incompatible with modular reduction") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMonkeySimulationWithoutRelief(t *testing.T) {
+	input := Input(monkeyNotesExample)
+
+	got, err := MonkeyInTheMiddle{}.SimulateWithoutRelief(&input, 20)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.MonkeyBusiness != 103*99 {
+		t.Fatalf("want monkey business %d, got %d", 103*99, got.MonkeyBusiness)
+	}
+	if got.Overflow == nil || got.Overflow.Round < 2 {
+		t.Fatalf("expected an overflow after the first round, got: %v", got.Overflow)
+	}
+}
+
+func TestMonkeyWorryOverflowReportsFirstOverflow(t *testing.T) {
+	p := MonkeyInTheMiddle{}
+	input, err := LoadInput(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	overflow := func(process func(monkeys []*Monkey) (map[MonkeyId]int, error)) *WorryOverflowError {
+		monkeys, err := p.parseNotes(&input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = process(monkeys)
+		var got *WorryOverflowError
+		if !errors.As(err, &got) {
+			t.Fatalf("expected a WorryOverflowError, got: %v", err)
+		}
+		return got
+	}
+
+	want := overflow(func(monkeys []*Monkey) (map[MonkeyId]int, error) {
+		return p.processRounds(20, p.noRelief, monkeys, nil)
+	})
+	if want.Round != 10 || want.Monkey != "0" {
+		t.Fatalf("expected the first overflow on round 10 by monkey 0, got: %v", want)
+	}
+	got := overflow(func(monkeys []*Monkey) (map[MonkeyId]int, error) {
+		return p.processManyRounds(perItemRounds, p.noRelief, monkeys)
+	})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestMonkeyNarrator(t *testing.T) {
+	input := Input(monkeyNotesExample)
+	var out strings.Builder
+
+	_, err := MonkeyInTheMiddle{}.Trace(&input, 1, true, NewMonkeyNarrator(&out))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantPrefix := `Monkey 0:
+  Monkey inspects an item with a worry level of 79.
+    Worry level is multiplied by 19 to 1501.
+    Monkey gets bored with item. Worry level is divided by 3 to 500.
+    Current worry level is not divisible by 23.
+    Item with worry level 500 is thrown to monkey 3.
+  Monkey inspects an item with a worry level of 98.
+    Worry level is multiplied by 19 to 1862.
+    Monkey gets bored with item. Worry level is divided by 3 to 620.
+    Current worry level is not divisible by 23.
+    Item with worry level 620 is thrown to monkey 3.
+Monkey 1:
+  Monkey inspects an item with a worry level of 54.
+    Worry level increases by 6 to 60.
+    Monkey gets bored with item. Worry level is divided by 3 to 20.
+    Current worry level is not divisible by 19.
+    Item with worry level 20 is thrown to monkey 0.
+`
+	wantSuffix := `  Monkey inspects an item with a worry level of 79.
+    Worry level is multiplied by itself to 6241.
+    Monkey gets bored with item. Worry level is divided by 3 to 2080.
+    Current worry level is divisible by 13.
+    Item with worry level 2080 is thrown to monkey 1.
+`
+	wantSummary := `
+After round 1, the monkeys are holding items with these worry levels:
+Monkey 0: 20, 23, 27, 26
+Monkey 1: 2080, 25, 167, 207, 401, 1046
+Monkey 2: 
+Monkey 3: 
+
+`
+	got := out.String()
+	if !strings.HasPrefix(got, wantPrefix) {
+		t.Fatalf("unexpected narrative:\n%s", got)
+	}
+	if !strings.Contains(got, wantSuffix) {
+		t.Fatalf("missing narrative of monkey 2:\n%s", got)
+	}
+	if !strings.HasSuffix(got, wantSummary) {
+		t.Fatalf("unexpected summary:\n%s", got)
+	}
+}
+
+func TestMonkeyRoundsPerItemMatchesReference(t *testing.T) {
+	p := MonkeyInTheMiddle{}
+	actual, err := LoadInput(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		input  Input
+		rounds int
+		relief ReliefMaker
+	}{
+		{name: "example, div by 3", input: monkeyNotesExample, rounds: 20, relief: p.divBy3Relief},
+		{name: "example, mod by divisors", input: monkeyNotesExample, rounds: 10000, relief: p.modByDivisorsRelief},
+		{name: "example, mod by divisors, odd rounds", input: monkeyNotesExample, rounds: 12345, relief: p.modByDivisorsRelief},
+		{name: "input, div by 3", input: actual, rounds: 20, relief: p.divBy3Relief},
+		{name: "input, mod by divisors", input: actual, rounds: 10000, relief: p.modByDivisorsRelief},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			monkeys, err := p.parseNotes(&tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := p.processRoundsPerItem(tc.rounds, tc.relief, monkeys)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want, err := p.processRounds(tc.rounds, tc.relief, monkeys, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMonkeyRoundsPerItemInTheBillions(t *testing.T) {
+	p := MonkeyInTheMiddle{}
+	input := Input(monkeyNotesExample)
+	process := func(rounds int, engine func(int, ReliefMaker, []*Monkey) (map[MonkeyId]int, error)) map[MonkeyId]int {
+		monkeys, err := p.parseNotes(&input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		counts, err := engine(rounds, p.modByDivisorsRelief, monkeys)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return counts
+	}
+	reference := func(rounds int, rm ReliefMaker, monkeys []*Monkey) (map[MonkeyId]int, error) {
+		return p.processRounds(rounds, rm, monkeys, nil)
+	}
+	// the items of the example enter cycles of 171 or 448 rounds within their
+	// first 175 rounds, so the inspections repeat every lcm(171, 448) rounds.
+	const rounds, period, offset = 5_000_000_000, 76_608, 5_000_000_000 % 76_608
+	before, after := process(offset, reference), process(offset+period, reference)
+	if diff := cmp.Diff(after, process(offset+period, p.processRoundsPerItem)); diff != "" {
+		t.Fatalf("unexpected diff after %d rounds (-want +got):\n%s", offset+period, diff)
+	}
+	extrapolated := map[MonkeyId]int{}
+	for id := range before {
+		extrapolated[id] = before[id] + (rounds-offset)/period*(after[id]-before[id])
+	}
+	want := map[MonkeyId]int{"0": 26088267533, "1": 23911732463, "2": 966282899, "3": 26010142537}
+	if diff := cmp.Diff(want, extrapolated); diff != "" {
+		t.Fatalf("unexpected extrapolation of the reference (-want +got):\n%s", diff)
+	}
+
+	got := process(rounds, p.processRoundsPerItem)
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+const terminalOutputExample = `$ cd /
+$ ls
+dir a
+14848514 b.txt
+8504156 c.dat
+dir d
+$ cd a
+$ ls
+dir e
+29116 f
+2557 g
+62596 h.lst
+$ cd e
+$ ls
+584 i
+$ cd ..
+$ cd ..
+$ cd d
+$ ls
+4060174 j
+8033020 d.log
+5626152 d.ext
+7214296 k`
+
+func TestFilesystemExport(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
 		{
-			puzzle: ProboscideaVolcanium{},
-			want:   Result{Part1: "?", Part2: "?"},
+			format: "tree",
+			want: `[48381165]  /
+├── [   94853]  a
+│   ├── [     584]  e
+│   │   └── [     584]  i
+│   ├── [   29116]  f
+│   ├── [    2557]  g
+│   └── [   62596]  h.lst
+├── [14848514]  b.txt
+├── [ 8504156]  c.dat
+└── [24933642]  d
+    ├── [ 5626152]  d.ext
+    ├── [ 8033020]  d.log
+    ├── [ 4060174]  j
+    └── [ 7214296]  k
+`,
 		},
 		{
-			puzzle: PyroclasticFlow{},
-			want:   Result{Part1: "?", Part2: "?"},
+			format: "du",
+			want: `48381165	/
+24933642	/d
+14848514	/b.txt
+8504156	/c.dat
+8033020	/d/d.log
+7214296	/d/k
+5626152	/d/d.ext
+4060174	/d/j
+94853	/a
+62596	/a/h.lst
+29116	/a/f
+2557	/a/g
+584	/a/e
+584	/a/e/i
+`,
 		},
 		{
-			puzzle: BoilingBoulders{},
-			want:   Result{Part1: "?", Part2: "?"},
+			format: "json",
+			want: `{
+  "name": "/",
+  "type": "dir",
+  "size": 48381165,
+  "entries": [
+    {
+      "name": "a",
+      "type": "dir",
+      "size": 94853,
+      "entries": [
+        {
+          "name": "e",
+          "type": "dir",
+          "size": 584,
+          "entries": [
+            {
+              "name": "i",
+              "type": "file",
+              "size": 584
+            }
+          ]
+        },
+        {
+          "name": "f",
+          "type": "file",
+          "size": 29116
+        },
+        {
+          "name": "g",
+          "type": "file",
+          "size": 2557
+        },
+        {
+          "name": "h.lst",
+          "type": "file",
+          "size": 62596
+        }
+      ]
+    },
+    {
+      "name": "b.txt",
+      "type": "file",
+      "size": 14848514
+    },
+    {
+      "name": "c.dat",
+      "type": "file",
+      "size": 8504156
+    },
+    {
+      "name": "d",
+      "type": "dir",
+      "size": 24933642,
+      "entries": [
+        {
+          "name": "d.ext",
+          "type": "file",
+          "size": 5626152
+        },
+        {
+          "name": "d.log",
+          "type": "file",
+          "size": 8033020
+        },
+        {
+          "name": "j",
+          "type": "file",
+          "size": 4060174
+        },
+        {
+          "name": "k",
+          "type": "file",
+          "size": 7214296
+        }
+      ]
+    }
+  ]
+}
+`,
 		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			input := Input(terminalOutputExample)
+			var out strings.Builder
+
+			err := NoSpaceLeftOnDevice{}.ExportFilesystem(&input, tc.format, &out)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTerminalOutputValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        Input
+		wantTree     string
+		wantUnlisted []string
+		wantErr      *ParseError
+	}{
 		{
-			puzzle: NotEnoughMinerals{},
-			want:   Result{Part1: "?", Part2: "?"},
+			name:  "re-listing is merged",
+			input: "$ cd /\n$ ls\ndir a\n10 b\n$ cd a\n$ ls\n5 c\n$ cd /\n$ ls\n10 b\ndir a",
+			wantTree: `[15]  /
+├── [ 5]  a
+│   └── [ 5]  c
+└── [10]  b
+`,
 		},
 		{
-			puzzle: GrovePositioningSystem{},
-			want:   Result{Part1: "?", Part2: "?"},
+			name:  "multi-segment and absolute paths",
+			input: "$ ls\ndir a\n$ cd a\n$ ls\ndir b\n$ cd b\n$ ls\n1 x\n$ cd ../../a/./b\n$ ls\n1 x\n$ cd /a/b/..\n$ ls\n2 y\ndir b",
+			wantTree: `[3]  /
+└── [3]  a
+    ├── [1]  b
+    │   └── [1]  x
+    └── [2]  y
+`,
 		},
 		{
-			puzzle: MonkeyMath{},
-			want:   Result{Part1: "?", Part2: "?"},
+			name:  "unlisted directories",
+			input: "$ cd /a/b\n$ ls\n7 x\n$ cd /\n$ ls\ndir a\ndir c",
+			wantTree: `[7]  /
+├── [7]  a (not listed)
+│   └── [7]  b
+│       └── [7]  x
+└── [0]  c (not listed)
+`,
+			wantUnlisted: []string{"/a", "/c"},
 		},
 		{
-			puzzle: MonkeyMap{},
-			want:   Result{Part1: "?", Part2: "?"},
+			name:    "file listed as directory",
+			input:   "$ ls\n10 a\n$ ls\ndir a",
+			wantErr: &ParseError{Day: 7, Line: 4, Column: 5, Text: "dir a", Expected: "an entry consistent with previous listings (a was previously listed as a file)"},
 		},
 		{
-			puzzle: UnstableDiffusion{},
-			want:   Result{Part1: "?", Part2: "?"},
+			name:    "file listed with different sizes",
+			input:   "$ ls\n10 a\n$ ls\n11 a",
+			wantErr: &ParseError{Day: 7, Line: 4, Column: 4, Text: "11 a", Expected: "an entry consistent with previous listings (a was previously listed with size 10)"},
 		},
 		{
-			puzzle: BlizzardBasin{},
-			want:   Result{Part1: "?", Part2: "?"},
+			name:    "cd into missing directory",
+			input:   "$ ls\ndir a\n$ cd b",
+			wantErr: &ParseError{Day: 7, Line: 3, Column: 6, Text: "$ cd b", Expected: "a reachable directory (dir b doesn't exist in /)"},
 		},
 		{
-			puzzle: FullOfHotAir{},
-			want:   Result{Part1: "?", Part2: "?"},
+			name:    "unknown command",
+			input:   "$ ls\ndir a\n$ rm a",
+			wantErr: &ParseError{Day: 7, Line: 3, Column: 3, Text: "$ rm a", Expected: `a supported command (cd or ls), got "rm"`},
 		},
 	}
 
 	for _, tc := range tests {
-		t.Run(tc.puzzle.Details().String(), func(t *testing.T) {
-			input, err := LoadInput(tc.puzzle)
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			err := NoSpaceLeftOnDevice{}.ExportFilesystem(&tc.input, "tree", &out)
+
+			if tc.wantErr != nil {
+				var gotErr *ParseError
+				if !errors.As(err, &gotErr) {
+					t.Fatalf("expected a ParseError, got: %v", err)
+				}
+				if diff := cmp.Diff(tc.wantErr, gotErr); diff != "" {
+					t.Fatalf("unexpected error diff (-want +got):\n%s", diff)
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			got, err := tc.puzzle.Solve(&input)
+			if diff := cmp.Diff(tc.wantTree, out.String()); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+			unlisted, err := NoSpaceLeftOnDevice{}.UnlistedDirs(&tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantUnlisted, unlisted); diff != "" {
+				t.Fatalf("unexpected unlisted dirs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFilesystemDeletionPlan(t *testing.T) {
+	nestedDirs := Input(`$ cd /
+$ ls
+dir a
+dir b
+1000 c
+$ cd a
+$ ls
+300 x
+50 v
+$ cd ../b
+$ ls
+400 y
+dir d
+$ cd d
+$ ls
+150 z
+50 u`)
+
+	testCases := []struct {
+		name         string
+		input        Input
+		freeSpace    int
+		includeFiles bool
+		want         DeletionPlan
+		wantErr      bool
+	}{
+		{
+			name:      "example: single dir",
+			input:     Input(terminalOutputExample),
+			freeSpace: 30000000,
+			want:      DeletionPlan{Paths: []string{"/d"}, Size: 24933642},
+		},
+		{
+			name:         "example: single file",
+			input:        Input(terminalOutputExample),
+			freeSpace:    30000000,
+			includeFiles: true,
+			want:         DeletionPlan{Paths: []string{"/c.dat"}, Size: 8504156},
+		},
+		{
+			name:      "enough free space",
+			input:     Input(terminalOutputExample),
+			freeSpace: 70000000 - 48381165,
+			want:      DeletionPlan{},
+		},
+		{
+			name:      "not enough disk space",
+			input:     Input(terminalOutputExample),
+			freeSpace: 70000001,
+			wantErr:   true,
+		},
+		{
+			name:         "far more than the disk space",
+			input:        Input(terminalOutputExample),
+			freeSpace:    60_000_000_000,
+			includeFiles: true,
+			wantErr:      true,
+		},
+		{
+			name:      "everything",
+			input:     nestedDirs,
+			freeSpace: 70000000,
+			want:      DeletionPlan{Paths: []string{"/"}, Size: 1950},
+		},
+		{
+			name:      "several dirs",
+			input:     nestedDirs,
+			freeSpace: 70000000 - 1950 + 620,
+			want:      DeletionPlan{Paths: []string{"/a", "/b"}, Size: 950},
+		},
+		{
+			name:         "dirs and files",
+			input:        nestedDirs,
+			freeSpace:    70000000 - 1950 + 680,
+			includeFiles: true,
+			want:         DeletionPlan{Paths: []string{"/a/x", "/b/y"}, Size: 700},
+		},
+	}
 
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NoSpaceLeftOnDevice{}.PlanDeletion(&tc.input, tc.freeSpace, tc.includeFiles)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got plan %v", got)
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -138,3 +1057,1073 @@ func TestSolutions(t *testing.T) {
 		})
 	}
 }
+
+const supplyStacksExample = `    [D]    
+[N] [C]    
+[Z] [M] [P]
+ 1   2   3 
+
+move 1 from 2 to 1
+move 3 from 1 to 3
+move 2 from 2 to 1
+move 1 from 1 to 2`
+
+func TestSupplyStacksRendering(t *testing.T) {
+	input := Input(supplyStacksExample)
+	var out strings.Builder
+	if err := (SupplyStacks{}).DumpRearrangement(&input, "9000", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `    [D]    
+[N] [C]    
+[Z] [M] [P]
+ 1   2   3 
+
+move 1 from 2 to 1
+[D]        
+[N] [C]    
+[Z] [M] [P]
+ 1   2   3 
+
+move 3 from 1 to 3
+        [Z]
+        [N]
+    [C] [D]
+    [M] [P]
+ 1   2   3 
+
+move 2 from 2 to 1
+        [Z]
+        [N]
+[M]     [D]
+[C]     [P]
+ 1   2   3 
+
+move 1 from 1 to 2
+        [Z]
+        [N]
+        [D]
+[C] [M] [P]
+ 1   2   3 
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSupplyStacksRenderingRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	for i := 0; i < 200; i++ {
+		var stacks []*stack
+		width := 1 + rnd.Intn(30) // beyond 9 stacks, numbers take two digits
+		for id := 1; id <= width; id++ {
+			s := &stack{id: id}
+			for n := rnd.Intn(8); n > 0; n-- {
+				s.push(crate('A' + rnd.Intn(26)))
+			}
+			stacks = append(stacks, s)
+		}
+		drawing := renderStacks(stacks)
+		got, err := parseStacks(strings.Split(strings.TrimSuffix(drawing, "\n"), "\n"))
+		if err != nil {
+			t.Fatalf("unexpected error parsing:\n%s\n%v", drawing, err)
+		}
+		if diff := cmp.Diff(stacks, got, cmp.AllowUnexported(stack{})); diff != "" {
+			t.Fatalf("unexpected diff parsing:\n%s\n(-want +got):\n%s", drawing, diff)
+		}
+	}
+}
+
+func TestSupplyStacksCraneModels(t *testing.T) {
+	tests := []struct {
+		model   string
+		want    string
+		wantErr bool
+	}{
+		{model: "9000", want: "CMZ"},
+		{model: "9001", want: "MCD"},
+		{model: "batch:1", want: "CMZ"},
+		{model: "batch:2", want: "MCZ"},
+		{model: "batch:3", want: "MCD"},
+		{model: "bottom", want: "DCM"},
+		{model: "batch:0", wantErr: true},
+		{model: "9002", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.model, func(t *testing.T) {
+			input := Input(supplyStacksExample)
+			r, err := SupplyStacks{}.Replay(&input, tc.model)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := r.Seek(4); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := r.TopCrates(); got != tc.want {
+				t.Fatalf("unexpected top crates: want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSupplyStacksReplay(t *testing.T) {
+	input := Input(supplyStacksExample)
+	r, err := SupplyStacks{}.Replay(&input, "9000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Undo() {
+		t.Fatalf("undid a step before carrying out any")
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Step(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	wantLog := []ReplayEntry{
+		{
+			Step:   "move 1 from 2 to 1",
+			Before: "    [D]    \n[N] [C]    \n[Z] [M] [P]\n 1   2   3 \n",
+			After:  "[D]        \n[N] [C]    \n[Z] [M] [P]\n 1   2   3 \n",
+		},
+		{
+			Step:   "move 3 from 1 to 3",
+			Before: "[D]        \n[N] [C]    \n[Z] [M] [P]\n 1   2   3 \n",
+			After:  "        [Z]\n        [N]\n    [C] [D]\n    [M] [P]\n 1   2   3 \n",
+		},
+	}
+	if diff := cmp.Diff(wantLog, r.Log()); diff != "" {
+		t.Fatalf("unexpected log (-want +got):\n%s", diff)
+	}
+
+	if !r.Undo() {
+		t.Fatalf("expected to undo a step")
+	}
+	if diff := cmp.Diff(wantLog[0].After, r.Drawing()); diff != "" {
+		t.Fatalf("unexpected drawing after undo (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantLog[:1], r.Log()); diff != "" {
+		t.Fatalf("unexpected log after undo (-want +got):\n%s", diff)
+	}
+
+	n, err := r.Bisect(func(top string) bool { return strings.HasSuffix(top, "Z") })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 || r.Done() != 2 || r.TopCrates() != "CZ" {
+		t.Fatalf("unexpected bisection: step %d, done %d, top crates %q", n, r.Done(), r.TopCrates())
+	}
+	n, err = r.Bisect(func(top string) bool { return top == "XYZ" })
+	if err != nil || n != -1 {
+		t.Fatalf("unexpected bisection: step %d, err %v", n, err)
+	}
+	if r.Done() != 2 || r.TopCrates() != "CZ" {
+		t.Fatalf("expected the replay back at step 2, got step %d with top crates %q", r.Done(), r.TopCrates())
+	}
+
+	if err := r.Seek(4); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Step(); err == nil {
+		t.Fatalf("expected an error after the last step")
+	}
+}
+
+func TestPacketParsing(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    string
+		wantErr *ParseError
+	}{
+		{line: "[1,[2,[3,[4,[5,6,7]]]],8,9]", want: "[1,[2,[3,[4,[5,6,7]]]],8,9]"},
+		{line: "[[]]", want: "[[]]"},
+		{line: " [ 1 ,\t[ -2 , 30 ] , [ ] ] ", want: "[1,[-2,30],[]]"},
+		{line: "[-10,-0]", want: "[-10,0]"},
+		{
+			line:    "[1,a]",
+			wantErr: &ParseError{Day: 13, Column: 4, Text: "[1,a]", Expected: "a digit, ',', '[' or ']'"},
+		},
+		{
+			line:    "[1,-]",
+			wantErr: &ParseError{Day: 13, Column: 5, Text: "[1,-]", Expected: "a digit after '-'"},
+		},
+		{
+			line:    "[1 2]",
+			wantErr: &ParseError{Day: 13, Column: 4, Text: "[1 2]", Expected: "',' or ']'"},
+		},
+		{
+			line:    "[1,,2]",
+			wantErr: &ParseError{Day: 13, Column: 4, Text: "[1,,2]", Expected: "an integer or '['"},
+		},
+		{
+			line:    "[1,]",
+			wantErr: &ParseError{Day: 13, Column: 4, Text: "[1,]", Expected: "an integer or '['"},
+		},
+		{
+			line:    "1",
+			wantErr: &ParseError{Day: 13, Column: 1, Text: "1", Expected: "'['"},
+		},
+		{
+			line:    "[1]]",
+			wantErr: &ParseError{Day: 13, Column: 4, Text: "[1]]", Expected: "end of packet"},
+		},
+		{
+			line:    "[99999999999999999999]",
+			wantErr: &ParseError{Day: 13, Column: 2, Text: "[99999999999999999999]", Expected: "an integer within range"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			got, err := DistressSignal{}.parsePacketLine(tc.line)
+			if tc.wantErr != nil {
+				if diff := cmp.Diff(tc.wantErr, err); diff != "" {
+					t.Fatalf("unexpected error diff (-want +got):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got.String()); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func FuzzPacketParsing(f *testing.F) {
+	f.Add("[1,[2,[3,[4,[5,6,7]]]],8,9]")
+	f.Add("[[4,4],4,4]")
+	f.Add(" [ -1 , [ ] ] ")
+	f.Add("[1,,2]")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		pkt, err := DistressSignal{}.parsePacketLine(line)
+		if err != nil {
+			return
+		}
+		canonical := pkt.String()
+		again, err := DistressSignal{}.parsePacketLine(canonical)
+		if err != nil {
+			t.Fatalf("canonical form %q of %q doesn't parse: %v", canonical, line, err)
+		}
+		if got := again.String(); got != canonical {
+			t.Fatalf("round trip of %q: want %q, got %q", line, canonical, got)
+		}
+		if pkt.compare(again) != 0 {
+			t.Fatalf("round trip of %q isn't equal to the original", line)
+		}
+	})
+}
+
+const distressSignalExample = `[1,1,3,1,1]
+[1,1,5,1,1]
+
+[[1],[2,3,4]]
+[[1],4]
+
+[9]
+[[8,7,6]]
+
+[[4,4],4,4]
+[[4,4],4,4,4]
+
+[7,7,7,7]
+[7,7,7]
+
+[]
+[3]
+
+[[[]]]
+[[]]
+
+[1,[2,[3,[4,[5,6,7]]]],8,9]
+[1,[2,[3,[4,[5,6,0]]]],8,9]`
+
+func TestPacketComparisonWalkthrough(t *testing.T) {
+	input := Input(distressSignalExample)
+	var out strings.Builder
+	if err := (DistressSignal{}).Explain(&input, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `== Pair 1 ==
+- Compare [1,1,3,1,1] vs [1,1,5,1,1]
+  - Compare 1 vs 1
+  - Compare 1 vs 1
+  - Compare 3 vs 5
+    - Left side is smaller, so inputs are in the right order
+
+== Pair 2 ==
+- Compare [[1],[2,3,4]] vs [[1],4]
+  - Compare [1] vs [1]
+    - Compare 1 vs 1
+  - Compare [2,3,4] vs 4
+    - Mixed types; convert right to [4] and retry comparison
+    - Compare [2,3,4] vs [4]
+      - Compare 2 vs 4
+        - Left side is smaller, so inputs are in the right order
+
+== Pair 3 ==
+- Compare [9] vs [[8,7,6]]
+  - Compare 9 vs [8,7,6]
+    - Mixed types; convert left to [9] and retry comparison
+    - Compare [9] vs [8,7,6]
+      - Compare 9 vs 8
+        - Right side is smaller, so inputs are not in the right order
+
+== Pair 4 ==
+- Compare [[4,4],4,4] vs [[4,4],4,4,4]
+  - Compare [4,4] vs [4,4]
+    - Compare 4 vs 4
+    - Compare 4 vs 4
+  - Compare 4 vs 4
+  - Compare 4 vs 4
+  - Left side ran out of items, so inputs are in the right order
+
+== Pair 5 ==
+- Compare [7,7,7,7] vs [7,7,7]
+  - Compare 7 vs 7
+  - Compare 7 vs 7
+  - Compare 7 vs 7
+  - Right side ran out of items, so inputs are not in the right order
+
+== Pair 6 ==
+- Compare [] vs [3]
+  - Left side ran out of items, so inputs are in the right order
+
+== Pair 7 ==
+- Compare [[[]]] vs [[]]
+  - Compare [[]] vs []
+    - Right side ran out of items, so inputs are not in the right order
+
+== Pair 8 ==
+- Compare [1,[2,[3,[4,[5,6,7]]]],8,9] vs [1,[2,[3,[4,[5,6,0]]]],8,9]
+  - Compare 1 vs 1
+  - Compare [2,[3,[4,[5,6,7]]]] vs [2,[3,[4,[5,6,0]]]]
+    - Compare 2 vs 2
+    - Compare [3,[4,[5,6,7]]] vs [3,[4,[5,6,0]]]
+      - Compare 3 vs 3
+      - Compare [4,[5,6,7]] vs [4,[5,6,0]]
+        - Compare 4 vs 4
+        - Compare [5,6,7] vs [5,6,0]
+          - Compare 5 vs 5
+          - Compare 6 vs 6
+          - Compare 7 vs 0
+            - Right side is smaller, so inputs are not in the right order
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestPacketComparisonDecision(t *testing.T) {
+	tests := []struct {
+		left, right  string
+		wantOrder    int
+		wantPath     []int
+		wantLeft     string
+		wantRight    string
+		wantPromoted bool
+	}{
+		{left: "[1,1,3,1,1]", right: "[1,1,5,1,1]", wantOrder: -1, wantPath: []int{2}, wantLeft: "3", wantRight: "5"},
+		{left: "[[1],[2,3,4]]", right: "[[1],4]", wantOrder: -1, wantPath: []int{1, 0}, wantLeft: "2", wantRight: "4", wantPromoted: true},
+		{left: "[9]", right: "[[8,7,6]]", wantOrder: 1, wantPath: []int{0, 0}, wantLeft: "9", wantRight: "8", wantPromoted: true},
+		{left: "[[4,4],4,4]", right: "[[4,4],4,4,4]", wantOrder: -1, wantLeft: "[[4,4],4,4]", wantRight: "[[4,4],4,4,4]"},
+		{left: "[[[]]]", right: "[[]]", wantOrder: 1, wantPath: []int{0}, wantLeft: "[[]]", wantRight: "[]"},
+		{left: "[1,[2,[3,[4,[5,6,7]]]],8,9]", right: "[1,[2,[3,[4,[5,6,0]]]],8,9]", wantOrder: 1, wantPath: []int{1, 1, 1, 1, 2}, wantLeft: "7", wantRight: "0"},
+		{left: "[[1],2]", right: "[1,[2]]", wantOrder: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.left+" vs "+tc.right, func(t *testing.T) {
+			left, _ := DistressSignal{}.parsePacketLine(tc.left)
+			right, _ := DistressSignal{}.parsePacketLine(tc.right)
+			got := left.explainCompare(right)
+
+			if got.order != tc.wantOrder || got.order != left.compare(right) {
+				t.Fatalf("unexpected order: want %d, got %d (compare: %d)", tc.wantOrder, got.order, left.compare(right))
+			}
+			if diff := cmp.Diff(tc.wantPath, got.path); diff != "" {
+				t.Fatalf("unexpected path (-want +got):\n%s", diff)
+			}
+			var gotLeft, gotRight string
+			if got.left != nil {
+				gotLeft, gotRight = got.left.String(), got.right.String()
+			}
+			if gotLeft != tc.wantLeft || gotRight != tc.wantRight {
+				t.Fatalf("unexpected values: want %s vs %s, got %s vs %s", tc.wantLeft, tc.wantRight, gotLeft, gotRight)
+			}
+			if got.promoted != tc.wantPromoted {
+				t.Fatalf("unexpected promotion: want %t, got %t", tc.wantPromoted, got.promoted)
+			}
+		})
+	}
+}
+
+func TestPacketDecoderKey(t *testing.T) {
+	tests := []struct {
+		dividers []string
+		want     int
+	}{
+		{dividers: []string{"[[2]]", "[[6]]"}, want: 140},
+		{dividers: []string{"[[6]]", "[[2]]"}, want: 140},
+		{dividers: []string{"[ [ 2 ] ]"}, want: 10},
+		{dividers: []string{"[]", "[10]", "[[1],4]"}, want: 1 * 19 * 10},
+		{dividers: []string{"[3]", "[3]"}, want: 10 * 11},
+		{dividers: nil, want: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(strings.Join(tc.dividers, " "), func(t *testing.T) {
+			input := Input(distressSignalExample)
+			got, err := DistressSignal{}.DecoderKey(&input, tc.dividers...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("unexpected key: want %d, got %d", tc.want, got)
+			}
+
+			// cross-check against sorting all packets, where each divider
+			// comes before equal packets and equal dividers given later
+			pairs, _ := DistressSignal{}.parse(&input)
+			var packets packetList
+			for _, d := range tc.dividers {
+				div, _ := DistressSignal{}.parsePacketLine(d)
+				packets = append(packets, div)
+			}
+			for _, pair := range pairs {
+				packets = append(packets, pair.left, pair.right)
+			}
+			indexes := make([]int, len(packets))
+			for i := range indexes {
+				indexes[i] = i
+			}
+			sort.Stable(indexedPackets{packets, indexes})
+			sorted := 1
+			for pos, i := range indexes {
+				if i < len(tc.dividers) {
+					sorted *= pos + 1
+				}
+			}
+			if sorted != got {
+				t.Fatalf("key differs from sorting: want %d, got %d", sorted, got)
+			}
+		})
+	}
+
+	input := Input(distressSignalExample)
+	_, err := DistressSignal{}.DecoderKey(&input, "[2")
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParseError, got: %v", err)
+	}
+}
+
+// indexedPackets sorts packets along with their original indexes.
+type indexedPackets struct {
+	packetList
+	indexes []int
+}
+
+func (p indexedPackets) Swap(i, j int) {
+	p.packetList.Swap(i, j)
+	p.indexes[i], p.indexes[j] = p.indexes[j], p.indexes[i]
+}
+
+const regolithReservoirExample = `498,4 -> 498,6 -> 496,6
+503,4 -> 502,4 -> 502,9 -> 494,9`
+
+func TestSandPouring(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        Input
+		source       point
+		floorPadding int
+		want         int
+		wantErr      bool
+	}{
+		{name: "example", input: regolithReservoirExample, source: point{500, 0}, floorPadding: -1, want: 24},
+		{name: "example with floor", input: regolithReservoirExample, source: point{500, 0}, floorPadding: 1, want: 93},
+		{
+			name:         "negative coordinates",
+			input:        "-502,-6 -> -502,-4 -> -504,-4\n-497,-6 -> -498,-6 -> -498,-1 -> -506,-1",
+			source:       point{-500, -10},
+			floorPadding: -1,
+			want:         24,
+		},
+		{
+			name:         "negative coordinates with floor",
+			input:        "-502,-6 -> -502,-4 -> -504,-4\n-497,-6 -> -498,-6 -> -498,-1 -> -506,-1",
+			source:       point{-500, -10},
+			floorPadding: 1,
+			want:         93,
+		},
+		{
+			name:         "far apart rocks",
+			input:        regolithReservoirExample + "\n100000,5 -> 100003,5\n-100000,1 -> -100000,3",
+			source:       point{500, 0},
+			floorPadding: 1,
+			want:         93,
+		},
+		{name: "single rock", input: "500,1", source: point{500, 0}, floorPadding: 20, want: 22*22 - 1},
+		{name: "no rocks", input: "", source: point{500, 0}, floorPadding: -1, want: 0},
+		{name: "no rocks with floor", input: "", source: point{500, 0}, floorPadding: 1, wantErr: true},
+		{name: "source below floor", input: regolithReservoirExample, source: point{500, 11}, floorPadding: 1, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var paths []rockPath
+			if tc.input != "" {
+				var err error
+				if paths, err = (RegolithReservoir{}).parse(&tc.input); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			engines := []sandEngine{stepEngine, pathEngine}
+			if tc.floorPadding >= 0 {
+				engines = append(engines, fillEngine)
+			}
+			for _, engine := range engines {
+				got, err := RegolithReservoir{}.countPouredUnitsOfSand(paths, tc.source, tc.floorPadding, engine)
+				if tc.wantErr {
+					if err == nil {
+						t.Fatalf("engine %d: expected an error, got %d", engine, got)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("engine %d: unexpected error: %v", engine, err)
+				}
+				if got != tc.want {
+					t.Fatalf("engine %d: unexpected units of sand: want %d, got %d", engine, tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSandEnginesAgree(t *testing.T) {
+	rnd := rand.New(rand.NewSource(14))
+	for i := 0; i < 100; i++ {
+		var paths []rockPath
+		for n := 1 + rnd.Intn(8); n > 0; n-- {
+			path := rockPath{{x: 480 + rnd.Intn(40), y: 1 + rnd.Intn(30)}}
+			for m := rnd.Intn(4); m > 0; m-- {
+				last := path[len(path)-1]
+				if m%2 == 0 {
+					path = append(path, point{x: last.x + rnd.Intn(11) - 5, y: last.y})
+				} else {
+					path = append(path, point{x: last.x, y: last.y + rnd.Intn(11) - 5})
+				}
+			}
+			paths = append(paths, path)
+		}
+
+		for _, floorPadding := range []int{-1, 0, 3} {
+			want, err := RegolithReservoir{}.countPouredUnitsOfSand(paths, point{500, 0}, floorPadding, stepEngine)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			engines := []sandEngine{pathEngine}
+			if floorPadding >= 0 {
+				engines = append(engines, fillEngine)
+			}
+			for _, engine := range engines {
+				got, err := RegolithReservoir{}.countPouredUnitsOfSand(paths, point{500, 0}, floorPadding, engine)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != want {
+					t.Fatalf("engine %d with floor padding %d disagrees on %v: want %d, got %d", engine, floorPadding, paths, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestCaveRendering(t *testing.T) {
+	input := Input(regolithReservoirExample)
+	var out strings.Builder
+	if err := (RegolithReservoir{}).Render(&input, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `......+...
+..........
+......o...
+.....ooo..
+....#ooo##
+...o#ooo#.
+..###ooo#.
+....oooo#.
+.o.ooooo#.
+#########.
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCaveRenderingOfDistantRocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   Input
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "rocks far from the sand are cropped",
+			input: regolithReservoirExample + "\n1000000000,0 -> 1000000000,1\n-1000000000,5 -> -999999999,5",
+			want: `......+...
+..........
+......o...
+.....ooo..
+....#ooo##
+...o#ooo#.
+..###ooo#.
+....oooo#.
+.o.ooooo#.
+#########.
+`,
+		},
+		{
+			name:    "sand too far from the source",
+			input:   "499,5000000 -> 501,5000000",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			err := (RegolithReservoir{}).Render(&tc.input, &out)
+
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got:\n%s", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCaveAnimation(t *testing.T) {
+	input := Input(regolithReservoirExample)
+	var out strings.Builder
+	if err := (RegolithReservoir{}).Animate(&input, true, 90, "text", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `After 0 units of sand:
+..........+..........
+.....................
+.....................
+.....................
+........#...##.......
+........#...#........
+......###...#........
+............#........
+............#........
+....#########........
+.....................
+#####################
+
+After 90 units of sand:
+..........+..........
+.........oo..........
+........oooo.........
+.......ooooooo.......
+......oo#ooo##o......
+.....ooo#ooo#ooo.....
+....oo###ooo#oooo....
+...oooo.oooo#ooooo...
+..oooooooooo#oooooo..
+.ooo#########ooooooo.
+ooooo.......ooooooooo
+#####################
+
+After 93 units of sand:
+..........o..........
+.........ooo.........
+........ooooo........
+.......ooooooo.......
+......oo#ooo##o......
+.....ooo#ooo#ooo.....
+....oo###ooo#oooo....
+...oooo.oooo#ooooo...
+..oooooooooo#oooooo..
+.ooo#########ooooooo.
+ooooo.......ooooooooo
+#####################
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := (RegolithReservoir{}).Animate(&input, false, 10, "gif", &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the animation: %v", err)
+	}
+	if len(anim.Image) != 4 { // 0, 10, 20 and 24 units of sand
+		t.Fatalf("unexpected number of frames: want 4, got %d", len(anim.Image))
+	}
+	if got, want := anim.Image[0].Bounds(), image.Rect(0, 0, 10*tileSize, 10*tileSize); got != want {
+		t.Fatalf("unexpected frame bounds: want %v, got %v", want, got)
+	}
+}
+
+const (
+	ropeMotionsExample      = "R 4\nU 4\nL 3\nD 1\nR 4\nD 1\nL 5\nR 2"
+	largerRopeMotionExample = "R 5\nU 8\nL 8\nD 3\nR 17\nD 10\nL 25\nU 20"
+)
+
+func TestRopeSimulation(t *testing.T) {
+	input := Input(ropeMotionsExample)
+	sim, err := RopeBridge{}.Simulate(&input, 2, ChebyshevFollow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out strings.Builder
+	if err := sim.ExportFrames(&out, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantStart := `== Initial State ==
+
+......
+......
+......
+......
+H.....
+
+== R 4 ==
+
+......
+......
+......
+......
+TH....
+
+......
+......
+......
+......
+sTH...
+`
+	if got := out.String(); !strings.HasPrefix(got, wantStart) {
+		t.Fatalf("unexpected frames (-want +got):\n%s", cmp.Diff(wantStart, got[:len(wantStart)]))
+	}
+
+	visited, err := sim.VisitedGrid(sim.Steps())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantVisited := `..##..
+...##.
+.####.
+....#.
+s###..
+`
+	if diff := cmp.Diff(wantVisited, visited); diff != "" {
+		t.Fatalf("unexpected visited grid (-want +got):\n%s", diff)
+	}
+
+	input = Input(largerRopeMotionExample)
+	sim, err = RopeBridge{}.Simulate(&input, 10, ChebyshevFollow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	grid, err := sim.Grid(13) // after R 5 and U 8
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantGrid := `..........................
+..........................
+..........................
+..........................
+..........................
+..........................
+..........................
+................H.........
+................1.........
+................2.........
+................3.........
+...............54.........
+..............6...........
+.............7............
+............8.............
+...........9..............
+..........................
+..........................
+..........................
+..........................
+..........................
+`
+	if diff := cmp.Diff(wantGrid, grid); diff != "" {
+		t.Fatalf("unexpected grid (-want +got):\n%s", diff)
+	}
+	if _, err := sim.Grid(sim.Steps() + 1); err == nil {
+		t.Fatalf("expected an error for a step out of range")
+	}
+
+	tail, err := sim.Trajectory(9)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	visitedByTail := map[Knot]bool{}
+	for _, k := range tail {
+		visitedByTail[k] = true
+	}
+	if len(tail) != 97 || len(visitedByTail) != 36 {
+		t.Fatalf("unexpected tail trajectory: %d positions, %d visited", len(tail), len(visitedByTail))
+	}
+}
+
+func TestRopeMotionsAndFollowRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		motions string
+		knots   int
+		rule    FollowRule
+		want    int
+	}{
+		{name: "example", motions: ropeMotionsExample, knots: 2, rule: ChebyshevFollow, want: 13},
+		{name: "larger example", motions: largerRopeMotionExample, knots: 10, rule: ChebyshevFollow, want: 36},
+		{name: "diagonal", motions: "UR 3", knots: 2, rule: ChebyshevFollow, want: 3},
+		{name: "vector", motions: "1,1 3", knots: 2, rule: ChebyshevFollow, want: 3},
+		{name: "long vector", motions: "2,0 2", knots: 2, rule: ChebyshevFollow, want: 4},
+		{name: "single knot", motions: "DL 2\n0,5 1", knots: 1, rule: ChebyshevFollow, want: 4},
+		{name: "manhattan", motions: "R 4", knots: 2, rule: ManhattanFollow, want: 4},
+		{name: "manhattan diagonal", motions: "UR 2", knots: 2, rule: ManhattanFollow, want: 4},
+		{name: "manhattan example", motions: ropeMotionsExample, knots: 2, rule: ManhattanFollow, want: 14},
+		{name: "long vectors", motions: "3,0 1\n0,4 1", knots: 2, rule: ChebyshevFollow, want: 6},
+		{name: "manhattan mixed motions", motions: "UR 3\nDR 2\n3,1 2", knots: 2, rule: ManhattanFollow, want: 18},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			input := Input(tc.motions)
+			motions, err := parseMotions(&input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := countPositionsVisitedByTail(tc.knots, motions, tc.rule); got != tc.want {
+				t.Fatalf("unexpected positions visited by the tail: want %d, got %d", tc.want, got)
+			}
+			sim := simulateRope(tc.knots, motions, tc.rule)
+			grid, err := sim.VisitedGrid(sim.Steps())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.Count(grid, "#") + strings.Count(grid, "s"); got != tc.want {
+				t.Fatalf("unexpected positions in the visited grid: want %d, got %d\n%s", tc.want, got, grid)
+			}
+		})
+	}
+}
+
+func TestRopeMotionParsing(t *testing.T) {
+	input := Input("UL 2\nD 1\n2,-1 3\n-3,0 1")
+	motions, err := parseMotions(&input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Motion{
+		{Dir: Delta{X: -1, Y: -1}, Steps: 2},
+		{Dir: Delta{X: 1, Y: 0}, Steps: 1},
+		{Dir: Delta{X: 1, Y: 2}, Steps: 3},
+		{Dir: Delta{X: 0, Y: -3}, Steps: 1},
+	}
+	if diff := cmp.Diff(want, motions); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+	var got []string
+	for _, m := range motions {
+		got = append(got, m.String())
+	}
+	if diff := cmp.Diff([]string{"UL 2", "D 1", "2,-1 3", "-3,0 1"}, got); diff != "" {
+		t.Fatalf("unexpected motions (-want +got):\n%s", diff)
+	}
+
+	for _, line := range []string{"LU 1", "1, 2 3", "R -1", "99999999999999999999,0 1"} {
+		input := Input(line)
+		var perr *ParseError
+		if _, err := parseMotions(&input); !errors.As(err, &perr) {
+			t.Fatalf("%q: expected a ParseError, got: %v", line, err)
+		}
+	}
+}
+
+func TestTreeVisibilityAndScenicScoresMatchBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(8))
+	for i := 0; i < 500; i++ {
+		forest := make(TreeHeights, 1+rnd.Intn(15))
+		width := 1 + rnd.Intn(15)
+		maxHeight := 1 + rnd.Intn(10) // low forests have many trees of equal height
+		for r := range forest {
+			forest[r] = make([]int, width)
+			for c := range forest[r] {
+				forest[r][c] = rnd.Intn(maxHeight)
+			}
+		}
+
+		if diff := cmp.Diff(forest.visibleTreesBruteForce(), forest.VisibleTrees()); diff != "" {
+			t.Fatalf("unexpected visibility of %v (-want +got):\n%s", forest, diff)
+		}
+		if diff := cmp.Diff(forest.scenicScoresBruteForce(), forest.ScenicScores()); diff != "" {
+			t.Fatalf("unexpected scenic scores of %v (-want +got):\n%s", forest, diff)
+		}
+	}
+}
+
+const treeHeightsExample = `30373
+25512
+65332
+33549
+35390`
+
+func TestTreeRendering(t *testing.T) {
+	input := Input(treeHeightsExample)
+	var out strings.Builder
+	if err := (TreetopTreeHouse{}).RenderVisibility(&input, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `30373
+255.2
+65.32
+3.*.9
+35390
+21 of 25 trees are visible; the highest scenic score is 8 (row 4, column 3)
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+
+	heights, err := parseTreeHeights(&input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := (TreetopTreeHouse{}).renderScenicScores(heights.ScenicScores(), 100, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the heatmap: %v", err)
+	}
+	if got, want := img.Bounds(), image.Rect(0, 0, 100, 100); got != want {
+		t.Fatalf("unexpected bounds: want %v, got %v", want, got)
+	}
+	for _, tc := range []struct {
+		x, y int
+		want color.Color
+	}{
+		{x: 50, y: 70, want: bestTreeColor},    // best tree
+		{x: 10, y: 10, want: heatmapColors[0]}, // edge tree (score 0)
+		{x: 30, y: 30, want: heatmapColor(1, 8)},
+	} {
+		if diff := cmp.Diff(color.RGBAModel.Convert(tc.want), img.At(tc.x, tc.y)); diff != "" {
+			t.Fatalf("unexpected color at (%d, %d) (-want +got):\n%s", tc.x, tc.y, diff)
+		}
+	}
+}
+
+const beaconExclusionZoneExample = `Sensor at x=2, y=18: closest beacon is at x=-2, y=15
+Sensor at x=9, y=16: closest beacon is at x=10, y=16
+Sensor at x=13, y=2: closest beacon is at x=15, y=3
+Sensor at x=12, y=14: closest beacon is at x=10, y=16
+Sensor at x=10, y=20: closest beacon is at x=10, y=16
+Sensor at x=14, y=17: closest beacon is at x=10, y=16
+Sensor at x=8, y=7: closest beacon is at x=2, y=10
+Sensor at x=2, y=0: closest beacon is at x=2, y=10
+Sensor at x=0, y=11: closest beacon is at x=2, y=10
+Sensor at x=20, y=14: closest beacon is at x=25, y=17
+Sensor at x=17, y=20: closest beacon is at x=21, y=22
+Sensor at x=16, y=7: closest beacon is at x=15, y=3
+Sensor at x=14, y=3: closest beacon is at x=15, y=3
+Sensor at x=20, y=1: closest beacon is at x=15, y=3`
+
+func TestDistressBeaconSearch(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      Input
+		searchSize int
+		want       int
+	}{
+		{name: "example", input: beaconExclusionZoneExample, searchSize: 20, want: 56000011},
+		{
+			name: "gap on the edge of the area",
+			input: `Sensor at x=5, y=-4: closest beacon is at x=12, y=-4
+Sensor at x=-3, y=-4: closest beacon is at x=-2, y=-3
+Sensor at x=-4, y=-3: closest beacon is at x=2, y=-1
+Sensor at x=6, y=3: closest beacon is at x=6, y=12
+Sensor at x=7, y=2: closest beacon is at x=12, y=2
+Sensor at x=-4, y=11: closest beacon is at x=-4, y=18
+Sensor at x=6, y=12: closest beacon is at x=6, y=21`,
+			searchSize: 10,
+			want:       7, // position 0,7
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := BeaconExclusionZone{}
+			sensors, err := p.parse(&tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := p.computeDistressBeaconTuneFrequency(sensors, tc.searchSize, 4_000_000)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBeaconCoverageRendering(t *testing.T) {
+	input := Input(beaconExclusionZoneExample)
+	var buf bytes.Buffer
+	if err := (BeaconExclusionZone{}).Render(&input, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the image: %v", err)
+	}
+	// the viewport spans the sensors from 0,0 to 20,20, so each position is
+	// 1000/21 pixels wide.
+	if got, want := img.Bounds(), image.Rect(0, 0, 1000, 1000); got != want {
+		t.Fatalf("unexpected bounds: want %v, got %v", want, got)
+	}
+	for _, tc := range []struct {
+		name string
+		x, y int
+		want color.Color
+	}{
+		{name: "sensor", x: 8, y: 7, want: sensorColor},
+		{name: "beacon", x: 2, y: 10, want: beaconColor},
+		{name: "distress beacon", x: 14, y: 11, want: distressBeaconColor},
+	} {
+		px, py := (2*tc.x+1)*1000/42, (2*tc.y+1)*1000/42 // centre of the position
+		if diff := cmp.Diff(color.RGBAModel.Convert(tc.want), img.At(px, py)); diff != "" {
+			t.Fatalf("unexpected color of the %s at (%d, %d) (-want +got):\n%s", tc.name, tc.x, tc.y, diff)
+		}
+	}
+}
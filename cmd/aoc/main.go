@@ -0,0 +1,248 @@
+// Command aoc solves the puzzles using the inputs found in the inputs/ directory.
+// The inputs of the puzzles that support it (see aoc.StreamSolver) are read
+// as they're solved rather than loaded into memory first.
+//
+// Usage:
+//
+//	go run ./cmd/aoc [-day N] [-render FILE]
+//	go run ./cmd/aoc -day 5 -crane 9000|9001|batch:N|bottom
+//	go run ./cmd/aoc -day 7 -export tree|du|json
+//	go run ./cmd/aoc -day 8 -visibility
+//	go run ./cmd/aoc -day 9 -frames [-knots N]
+//	go run ./cmd/aoc -day 11 [-trace] [-no-relief] [-rounds N]
+//	go run ./cmd/aoc -day 13 -explain
+//	go run ./cmd/aoc -day 14 -animate FILE [-floor] [-grains N]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	aoc "github.com/marcelocenerine/adventofcode"
+)
+
+var puzzles = []aoc.Puzzle{
+	aoc.CalorieCounting{},
+	aoc.RockPaperScissors{},
+	aoc.RucksackReorganization{},
+	aoc.CampCleanup{},
+	aoc.SupplyStacks{},
+	aoc.TuningTrouble{},
+	aoc.NoSpaceLeftOnDevice{},
+	aoc.TreetopTreeHouse{},
+	aoc.RopeBridge{},
+	aoc.CathodeRayTube{},
+	aoc.MonkeyInTheMiddle{},
+	aoc.HillClimbingAlgorithm{},
+	aoc.DistressSignal{},
+	aoc.RegolithReservoir{},
+	aoc.BeaconExclusionZone{},
+	aoc.ProboscideaVolcanium{},
+	aoc.PyroclasticFlow{},
+	aoc.BoilingBoulders{},
+	aoc.NotEnoughMinerals{},
+	aoc.GrovePositioningSystem{},
+	aoc.MonkeyMath{},
+	aoc.MonkeyMap{},
+	aoc.UnstableDiffusion{},
+	aoc.BlizzardBasin{},
+	aoc.FullOfHotAir{},
+}
+
+type options struct {
+	day      int
+	render   string
+	crane    string
+	export   string
+	noRelief bool
+	trace    bool
+	rounds   int
+	visible  bool
+	frames   bool
+	knots    int
+	explain  bool
+	animate  string
+	floor    bool
+	grains   int
+}
+
+func main() {
+	var opts options
+	flag.IntVar(&opts.day, "day", 0, "day of the puzzle to run (all days when omitted)")
+	flag.StringVar(&opts.render, "render", "", "write a rendering of the puzzle input to `file` (requires -day)")
+	flag.StringVar(&opts.crane, "crane", "", "print the day 5 stacks after each step carried out by the given crane `model` (9000, 9001, batch:N or bottom)")
+	flag.StringVar(&opts.export, "export", "", "print the day 7 filesystem in the given `format` (tree, du or json)")
+	flag.BoolVar(&opts.visible, "visibility", false, "print a map of the day 8 trees visible from outside the grid")
+	flag.BoolVar(&opts.frames, "frames", false, "print the day 9 rope after each motion")
+	flag.IntVar(&opts.knots, "knots", 10, "number of knots of the rope with -frames")
+	flag.BoolVar(&opts.noRelief, "no-relief", false, "simulate day 11 without relieving worry levels")
+	flag.BoolVar(&opts.trace, "trace", false, "narrate the day 11 simulation round by round")
+	flag.IntVar(&opts.rounds, "rounds", 20, "number of rounds to simulate with -no-relief or -trace")
+	flag.BoolVar(&opts.explain, "explain", false, "walk through the day 13 comparisons of every pair of packets")
+	flag.StringVar(&opts.animate, "animate", "", "write frames of the day 14 sand pouring to `file` (an animated GIF if it ends with .gif, text otherwise)")
+	flag.BoolVar(&opts.floor, "floor", false, "animate the day 14 cave with a floor")
+	flag.IntVar(&opts.grains, "grains", 100, "number of grains of sand between frames with -animate")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	if opts.render != "" && opts.day == 0 {
+		return fmt.Errorf("-render requires -day")
+	}
+	if opts.crane != "" && opts.day != 5 {
+		return fmt.Errorf("-crane requires -day 5")
+	}
+	if opts.export != "" && opts.day != 7 {
+		return fmt.Errorf("-export requires -day 7")
+	}
+	if opts.visible && opts.day != 8 {
+		return fmt.Errorf("-visibility requires -day 8")
+	}
+	if opts.frames && opts.day != 9 {
+		return fmt.Errorf("-frames requires -day 9")
+	}
+	if (opts.noRelief || opts.trace) && opts.day != 11 {
+		return fmt.Errorf("-no-relief and -trace require -day 11")
+	}
+	if opts.explain && opts.day != 13 {
+		return fmt.Errorf("-explain requires -day 13")
+	}
+	if (opts.animate != "" || opts.floor) && opts.day != 14 {
+		return fmt.Errorf("-animate and -floor require -day 14")
+	}
+
+	for _, p := range puzzles {
+		if opts.day != 0 && p.Details().Day != opts.day {
+			continue
+		}
+		if s, ok := p.(aoc.StreamSolver); ok && opts.solving() {
+			result, err := solveStream(p, s)
+			if err := report(p, result, err); err != nil {
+				return err
+			}
+			continue
+		}
+		input, err := aoc.LoadInput(p)
+		if err != nil {
+			return err
+		}
+		if opts.render != "" {
+			return renderTo(p, &input, opts.render)
+		}
+		if opts.crane != "" {
+			return aoc.SupplyStacks{}.DumpRearrangement(&input, opts.crane, os.Stdout)
+		}
+		if opts.export != "" {
+			return aoc.NoSpaceLeftOnDevice{}.ExportFilesystem(&input, opts.export, os.Stdout)
+		}
+		if opts.visible {
+			return aoc.TreetopTreeHouse{}.RenderVisibility(&input, os.Stdout)
+		}
+		if opts.frames {
+			sim, err := aoc.RopeBridge{}.Simulate(&input, opts.knots, aoc.ChebyshevFollow)
+			if err != nil {
+				return err
+			}
+			return sim.ExportFrames(os.Stdout, false)
+		}
+		if opts.trace {
+			_, err := aoc.MonkeyInTheMiddle{}.Trace(&input, opts.rounds, !opts.noRelief, aoc.NewMonkeyNarrator(os.Stdout))
+			return err
+		}
+		if opts.animate != "" {
+			return animateTo(&input, opts.animate, opts.floor, opts.grains)
+		}
+		if opts.explain {
+			return aoc.DistressSignal{}.Explain(&input, os.Stdout)
+		}
+		if opts.noRelief {
+			return simulateWithoutRelief(&input, opts.rounds)
+		}
+		result, err := p.Solve(&input)
+		if err := report(p, result, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// solving tells whether the puzzles are just solved, rather than explored
+// through one of the day specific options.
+func (opts options) solving() bool {
+	return opts.render == "" && opts.crane == "" && opts.export == "" && !opts.visible && !opts.frames &&
+		!opts.trace && opts.animate == "" && !opts.explain && !opts.noRelief
+}
+
+func solveStream(p aoc.Puzzle, s aoc.StreamSolver) (aoc.Result, error) {
+	f, err := aoc.OpenInput(p)
+	if err != nil {
+		return aoc.Result{}, err
+	}
+	defer f.Close()
+	return s.SolveStream(f)
+}
+
+// report prints the result of the puzzle, or returns the error solving it.
+func report(p aoc.Puzzle, result aoc.Result, err error) error {
+	var perr *aoc.ParseError
+	if errors.As(err, &perr) {
+		return fmt.Errorf("%s: %w\n%s", p.Details(), err, perr.Excerpt())
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.Details(), err)
+	}
+	fmt.Printf("%s\nPart 1: %s\nPart 2: %s\n\n", p.Details(), result.Part1, result.Part2)
+	return nil
+}
+
+func renderTo(p aoc.Puzzle, input *aoc.Input, path string) error {
+	r, ok := p.(aoc.Renderer)
+	if !ok {
+		return fmt.Errorf("%s: rendering is not supported", p.Details())
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Render(input, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func animateTo(input *aoc.Input, path string, floor bool, grains int) error {
+	format := "text"
+	if strings.HasSuffix(path, ".gif") {
+		format = "gif"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := (aoc.RegolithReservoir{}).Animate(input, floor, grains, format, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func simulateWithoutRelief(input *aoc.Input, rounds int) error {
+	sim, err := aoc.MonkeyInTheMiddle{}.SimulateWithoutRelief(input, rounds)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Monkey business after %d rounds without relief: %d\n", rounds, sim.MonkeyBusiness)
+	if sim.Overflow != nil {
+		fmt.Printf("Worry levels exceeded the int range (%v); the simulation used arbitrary precision.\n", sim.Overflow)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package adventofcode
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"strconv"
 )
@@ -14,7 +15,11 @@ func (c CalorieCounting) Details() Details {
 }
 
 func (c CalorieCounting) Solve(input *Input) (Result, error) {
-	caloriesPerElf, err := caloriesCount(input)
+	return c.SolveStream(input.Reader())
+}
+
+func (c CalorieCounting) SolveStream(r io.Reader) (Result, error) {
+	caloriesPerElf, err := caloriesCount(NewParagraphIterator(r))
 	if err != nil {
 		return Result{}, err
 	}
@@ -30,22 +35,27 @@ func (c CalorieCounting) Solve(input *Input) (Result, error) {
 	}, nil
 }
 
-func caloriesCount(input *Input) ([]int, error) {
+func caloriesCount(elves *Iterator) ([]int, error) {
 	var caloriesPerElf []int
-	var curElfCalories int
 
-	for _, line := range input.Lines() {
-		if len(line) == 0 {
-			caloriesPerElf = append(caloriesPerElf, curElfCalories)
-			curElfCalories = 0
-			continue
+	for elves.Next() {
+		var curElfCalories int
+		for i, line := range elves.Record() {
+			calories, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, &ParseError{
+					Day:      CalorieCounting{}.Details().Day,
+					Line:     elves.Line() + i,
+					Text:     line,
+					Expected: "a number of calories",
+				}
+			}
+			curElfCalories += calories
 		}
-
-		calories, err := strconv.Atoi(line)
-		if err != nil {
-			return nil, err
-		}
-		curElfCalories += calories
+		caloriesPerElf = append(caloriesPerElf, curElfCalories)
+	}
+	if err := elves.Err(); err != nil {
+		return nil, err
 	}
 
 	sort.Sort(sort.Reverse(sort.IntSlice(caloriesPerElf)))
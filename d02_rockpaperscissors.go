@@ -102,10 +102,15 @@ func calculatePlayerTotalScore(rounds []Round, strategy Strategy) int {
 func parseRounds(input *Input) ([]Round, error) {
 	lines := input.Lines()
 	rounds := make([]Round, len(lines))
-	for i, line := range input.Lines() {
+	for i, line := range lines {
 		round, err := parseRound(line)
 		if err != nil {
-			return nil, err
+			return nil, &ParseError{
+				Day:      RockPaperScissors{}.Details().Day,
+				Line:     i + 1,
+				Text:     line,
+				Expected: "an opponent shape (A, B or C) and a response (X, Y or Z) separated by a space",
+			}
 		}
 		rounds[i] = round
 	}
@@ -84,9 +84,11 @@ func parseRucksacks(input *Input) ([]rucksack, error) {
 	lines := input.Lines()
 	rucksacks := make([]rucksack, 0, len(lines))
 
-	for _, line := range lines {
+	for i, line := range lines {
 		rs, err := parseRucksack(line)
 		if err != nil {
+			err.Day = RucksackReorganization{}.Details().Day
+			err.Line = i + 1
 			return nil, err
 		}
 		rucksacks = append(rucksacks, rs)
@@ -94,16 +96,17 @@ func parseRucksacks(input *Input) ([]rucksack, error) {
 	return rucksacks, nil
 }
 
-var rucksackRgx = regexp.MustCompile("[a-zA-Z]")
+var invalidItemRgx = regexp.MustCompile("[^a-zA-Z]")
 
-func parseRucksack(line string) (rucksack, error) {
+// parseRucksack returns a ParseError without the day and line set.
+func parseRucksack(line string) (rucksack, *ParseError) {
 	rs := rucksack{items: []item(line)}
+	if loc := invalidItemRgx.FindStringIndex(line); loc != nil {
+		return rs, &ParseError{Column: column(line, loc[0]), Text: line, Expected: "an item (a-z or A-Z)"}
+	}
 	rcount := utf8.RuneCountInString(line)
 	if rcount == 0 || rcount%2 != 0 {
-		return rs, fmt.Errorf("rucksack is empty or contains an odd number of items: %s", line)
-	}
-	if !rucksackRgx.MatchString(line) {
-		return rs, fmt.Errorf("rucksack contains invalid items: %s", line)
+		return rs, &ParseError{Column: rcount + 1, Text: line, Expected: "a non-empty even number of items"}
 	}
 
 	rs.left = mkCompartment(line[:rcount/2])
@@ -112,14 +115,14 @@ func parseRucksack(line string) (rucksack, error) {
 	for lr, _ := range rs.left {
 		if _, ok := rs.right[lr]; ok {
 			if rs.common > 0 {
-				return rs, fmt.Errorf("rucksack contains multiple common items in the two compartments: %s", line)
+				return rs, &ParseError{Text: line, Expected: "a single item type common to both compartments"}
 			}
 			rs.common = item(lr)
 		}
 	}
 
 	if rs.common == 0 {
-		return rs, fmt.Errorf("rucksack contains no common item in the two compartments: %s", line)
+		return rs, &ParseError{Text: line, Expected: "an item type common to both compartments"}
 	}
 	return rs, nil
 }
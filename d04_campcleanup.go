@@ -69,7 +69,12 @@ func parseAssignments(input *Input) ([]assignment, error) {
 	for i, line := range lines {
 		as, err := parseAssignment(line)
 		if err != nil {
-			return nil, err
+			return nil, &ParseError{
+				Day:      CampCleanup{}.Details().Day,
+				Line:     i + 1,
+				Text:     line,
+				Expected: "a pair of section ranges such as 2-4,6-8",
+			}
 		}
 		assignments[i] = as
 	}
@@ -3,10 +3,12 @@ package adventofcode
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
+	"io"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 type SupplyStacks struct{}
@@ -33,6 +35,205 @@ func (s SupplyStacks) Solve(input *Input) (Result, error) {
 	return Result{Part1: results[0], Part2: results[1]}, nil
 }
 
+// DumpRearrangement writes the drawing of the stacks before the
+// rearrangement and after each of its steps, carried out by the given crane
+// model (see newCrane).
+func (s SupplyStacks) DumpRearrangement(input *Input, model string, w io.Writer) error {
+	r, err := s.Replay(input, model)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, r.Drawing()); err != nil {
+		return err
+	}
+	for !r.Finished() {
+		if err := r.Step(); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "\n%v\n%s", r.steps[r.Done()-1], r.Drawing()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay carries out a rearrangement one step at a time, keeping the stacks
+// as they were before each step so that steps can be undone.
+type Replay struct {
+	crane crane
+	steps []step
+	// history holds the initial stacks followed by the stacks after each
+	// step carried out.
+	history [][]*stack
+}
+
+// ReplayEntry describes a step carried out, with the drawings of the stacks
+// before and after it.
+type ReplayEntry struct {
+	Step          string
+	Before, After string
+}
+
+// Replay parses the input and returns a replay of its rearrangement by the
+// given crane model (see newCrane), with no steps carried out yet.
+func (s SupplyStacks) Replay(input *Input, model string) (*Replay, error) {
+	cm, err := newCrane(model)
+	if err != nil {
+		return nil, err
+	}
+	stacks, arrangement, err := parseSupplyStacksInput(input)
+	if err != nil {
+		return nil, err
+	}
+	return &Replay{crane: cm, steps: arrangement, history: [][]*stack{stacks}}, nil
+}
+
+// Done returns the number of steps carried out.
+func (r *Replay) Done() int {
+	return len(r.history) - 1
+}
+
+// Finished tells whether all the steps were carried out.
+func (r *Replay) Finished() bool {
+	return r.Done() == len(r.steps)
+}
+
+// Step carries out the next step.
+func (r *Replay) Step() error {
+	if r.Finished() {
+		return fmt.Errorf("all %d steps were carried out", len(r.steps))
+	}
+	stacks := cloneStacks(r.current())
+	st := r.steps[r.Done()]
+	if _, err := rearrange(stacks, []step{st}, r.crane); err != nil {
+		return fmt.Errorf("step %d (%v): %w", r.Done()+1, st, err)
+	}
+	r.history = append(r.history, stacks)
+	return nil
+}
+
+// Undo reverts the last step carried out, if any.
+func (r *Replay) Undo() bool {
+	if r.Done() == 0 {
+		return false
+	}
+	r.history = r.history[:len(r.history)-1]
+	return true
+}
+
+// Seek carries out or undoes steps until exactly n steps are carried out.
+func (r *Replay) Seek(n int) error {
+	if n < 0 || n > len(r.steps) {
+		return fmt.Errorf("step %d out of range [0, %d]", n, len(r.steps))
+	}
+	for r.Done() > n {
+		r.Undo()
+	}
+	for r.Done() < n {
+		if err := r.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bisect returns the number of steps after which the top crates first
+// satisfy the given predicate, which is assumed to keep holding from then
+// on, or -1 if it never does. When found, the replay is left at that step;
+// otherwise (or on error) it's taken back to the step it was at.
+func (r *Replay) Bisect(bad func(topCrates string) bool) (int, error) {
+	start := r.Done()
+	var err error
+	n := sort.Search(len(r.steps)+1, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		if err = r.Seek(i); err != nil {
+			return true
+		}
+		return bad(r.TopCrates())
+	})
+	if err != nil {
+		r.Seek(start) // can't fail, as the steps up to start were carried out before
+		return 0, err
+	}
+	if n > len(r.steps) {
+		return -1, r.Seek(start)
+	}
+	return n, r.Seek(n)
+}
+
+// TopCrates returns the crates on top of each stack.
+func (r *Replay) TopCrates() string {
+	return topCrates(r.current())
+}
+
+// Drawing returns the drawing of the stacks in the format of the puzzle
+// input.
+func (r *Replay) Drawing() string {
+	return renderStacks(r.current())
+}
+
+// Log returns the steps carried out so far.
+func (r *Replay) Log() []ReplayEntry {
+	log := make([]ReplayEntry, r.Done())
+	for i := range log {
+		log[i] = ReplayEntry{
+			Step:   r.steps[i].String(),
+			Before: renderStacks(r.history[i]),
+			After:  renderStacks(r.history[i+1]),
+		}
+	}
+	return log
+}
+
+func (r *Replay) current() []*stack {
+	return r.history[len(r.history)-1]
+}
+
+func cloneStacks(stacks []*stack) []*stack {
+	result := make([]*stack, len(stacks))
+	for i, s := range stacks {
+		result[i] = &stack{id: s.id, crates: append([]crate(nil), s.crates...)}
+	}
+	return result
+}
+
+// renderStacks draws the stacks in the format of the puzzle input. Stack
+// numbers are centered under the crates, leaning right when they have two
+// digits.
+func renderStacks(stacks []*stack) string {
+	height := 0
+	for _, s := range stacks {
+		if s.size() > height {
+			height = s.size()
+		}
+	}
+	var b strings.Builder
+	for row := height - 1; row >= 0; row-- {
+		for i, s := range stacks {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if row < s.size() {
+				fmt.Fprintf(&b, "[%v]", s.crates[row])
+			} else {
+				b.WriteString("   ")
+			}
+		}
+		b.WriteByte('\n')
+	}
+	for i, s := range stacks {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		id := strconv.Itoa(s.id)
+		fmt.Fprintf(&b, "%-3s", strings.Repeat(" ", (4-len(id))/2)+id)
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
 func topCrates(stacks []*stack) string {
 	var buffer bytes.Buffer
 	for _, s := range stacks {
@@ -53,6 +254,30 @@ type crane interface {
 	move(n int, from, to *stack) error
 }
 
+var batchCraneRgx = regexp.MustCompile(`^batch:(\d+)$`)
+
+// newCrane returns the crane of the given model, which is one of:
+//   - "9000": the CrateMover 9000, moving one crate at a time
+//   - "9001": the CrateMover 9001, moving all the crates at once
+//   - "batch:N": a crane moving up to N crates at once
+//   - "bottom": a crane taking crates from the bottom of the stack
+func newCrane(model string) (crane, error) {
+	switch model {
+	case "9000":
+		return cm9000{}, nil
+	case "9001":
+		return cm9001{}, nil
+	case "bottom":
+		return cmBottom{}, nil
+	}
+	if groups := batchCraneRgx.FindStringSubmatch(model); groups != nil {
+		if capacity, err := strconv.Atoi(groups[1]); err == nil && capacity > 0 {
+			return cmBatch{capacity: capacity}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported crane model: %s", model)
+}
+
 type cm9000 struct{}
 
 func (cm cm9000) move(n int, from, to *stack) error {
@@ -78,6 +303,45 @@ func (cm cm9001) move(n int, from, to *stack) error {
 	return nil
 }
 
+// cmBatch moves crates in batches of up to capacity crates, keeping the
+// order of the crates within each batch. With a capacity of 1 it behaves like
+// the CrateMover 9000 and with a capacity of at least n like the CrateMover
+// 9001.
+type cmBatch struct {
+	capacity int
+}
+
+func (cm cmBatch) move(n int, from, to *stack) error {
+	if from.size() < n {
+		return fmt.Errorf("from.size < n: size=%d, n=%d", from.size(), n)
+	}
+	for n > 0 {
+		batch := n
+		if batch > cm.capacity {
+			batch = cm.capacity
+		}
+		if err := (cm9001{}).move(batch, from, to); err != nil {
+			return err
+		}
+		n -= batch
+	}
+	return nil
+}
+
+// cmBottom takes the n crates at the bottom of the stack at once, putting
+// them on top of the other stack in the same order.
+type cmBottom struct{}
+
+func (cm cmBottom) move(n int, from, to *stack) error {
+	if from.size() < n {
+		return fmt.Errorf("from.size < n: size=%d, n=%d", from.size(), n)
+	}
+	crates := append([]crate(nil), from.crates[:n]...)
+	from.crates = from.crates[n:]
+	to.crates = append(to.crates, crates...)
+	return nil
+}
+
 type stack struct {
 	id     int
 	crates []crate
@@ -111,6 +375,10 @@ type step struct {
 	n, from, to int
 }
 
+func (s step) String() string {
+	return fmt.Sprintf("move %d from %d to %d", s.n, s.from, s.to)
+}
+
 var arrangementRgx = regexp.MustCompile(`^move (\d+) from (\d+) to (\d+)$`)
 
 func parseSupplyStacksInput(input *Input) ([]*stack, []step, error) {
@@ -125,7 +393,7 @@ func parseSupplyStacksInput(input *Input) ([]*stack, []step, error) {
 			if err != nil {
 				return nil, nil, err
 			}
-			arrs, err := parseArrangement(lines[i+1:])
+			arrs, err := parseArrangement(lines[i+1:], i+2)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -133,24 +401,44 @@ func parseSupplyStacksInput(input *Input) ([]*stack, []step, error) {
 		}
 	}
 
-	return nil, nil, errors.New("empty line separating stacks and arrangement not found in the input")
+	return nil, nil, &ParseError{
+		Day:      SupplyStacks{}.Details().Day,
+		Line:     len(lines) + 1,
+		Expected: "an empty line separating stacks and arrangement",
+	}
 }
 
 func parseStacks(lines []string) ([]*stack, error) {
-	if len(lines) < 2 {
-		return nil, errors.New("invalid stacks")
+	if len(lines) == 0 {
+		return nil, &ParseError{
+			Day:      SupplyStacks{}.Details().Day,
+			Line:     1,
+			Expected: "rows of crates followed by the stack numbers",
+		}
 	}
-	length := len(lines[0])
-	var result []*stack
-	for i := len(lines) - 2; i >= 0; i-- { // discards the bottom line
+	base := lines[len(lines)-1]
+	result, err := parseStackNumbers(base)
+	if err != nil {
+		err.Line = len(lines)
+		return nil, err
+	}
+	length := len(base)
+	for i := len(lines) - 2; i >= 0; i-- {
 		line := lines[i]
 		if len(line) != length {
-			return nil, errors.New("lines in the stack has inconsistent lengths")
-		}
-		for c, s := 1, 0; c < length; c, s = c+4, s+1 {
-			if len(result) == s {
-				result = append(result, &stack{id: s + 1})
+			col := len(line)
+			if length < col {
+				col = length
 			}
+			return nil, &ParseError{
+				Day:      SupplyStacks{}.Details().Day,
+				Line:     i + 1,
+				Column:   col + 1,
+				Text:     line,
+				Expected: fmt.Sprintf("a line %d characters long", length),
+			}
+		}
+		for c, s := 1, 0; c < length && s < len(result); c, s = c+4, s+1 {
 			if crt := crate(line[c]); crt != ' ' {
 				result[s].push(crt)
 			}
@@ -159,12 +447,46 @@ func parseStacks(lines []string) ([]*stack, error) {
 	return result, nil
 }
 
-func parseArrangement(lines []string) ([]step, error) {
+// parseStackNumbers creates the stacks numbered in the bottom line of the
+// drawing, which must count up from 1.
+func parseStackNumbers(line string) ([]*stack, *ParseError) {
+	var result []*stack
+	offset := 0
+	for _, field := range strings.Fields(line) {
+		offset += strings.Index(line[offset:], field)
+		if want := strconv.Itoa(len(result) + 1); field != want {
+			return nil, &ParseError{
+				Day:      SupplyStacks{}.Details().Day,
+				Column:   column(line, offset),
+				Text:     line,
+				Expected: fmt.Sprintf("stack number %s", want),
+			}
+		}
+		result = append(result, &stack{id: len(result) + 1})
+		offset += len(field)
+	}
+	if len(result) == 0 {
+		return nil, &ParseError{
+			Day:      SupplyStacks{}.Details().Day,
+			Text:     line,
+			Expected: "the stack numbers",
+		}
+	}
+	return result, nil
+}
+
+// parseArrangement parses the steps starting on the given (1-based) line.
+func parseArrangement(lines []string, firstLine int) ([]step, error) {
 	result := make([]step, len(lines))
 
 	for i, line := range lines {
 		if !arrangementRgx.MatchString(line) {
-			return result, fmt.Errorf("invalid step line: %s", line)
+			return result, &ParseError{
+				Day:      SupplyStacks{}.Details().Day,
+				Line:     firstLine + i,
+				Text:     line,
+				Expected: "a step such as 'move 1 from 2 to 3'",
+			}
 		}
 		groups := arrangementRgx.FindAllStringSubmatch(line, -1)
 		n, _ := strconv.Atoi(groups[0][1])
@@ -177,10 +499,10 @@ func parseArrangement(lines []string) ([]step, error) {
 
 func rearrange(stacks []*stack, arrangement []step, cm crane) ([]*stack, error) {
 	for _, step := range arrangement {
-		if step.from > len(stacks) {
+		if step.from < 1 || step.from > len(stacks) {
 			return nil, fmt.Errorf("invalid 'from' in step: %v", step)
 		}
-		if step.to > len(stacks) {
+		if step.to < 1 || step.to > len(stacks) {
 			return nil, fmt.Errorf("invalid 'to' in step: %v", step)
 		}
 		from := stacks[step.from-1]
@@ -25,7 +25,7 @@ const PacketMarkerLength = 4
 const MessageMarkerLength = 14
 
 func charCountUntilEndOfMarker(input *Input, markerLength int) int {
-	runes := []rune(*input)
+	runes := []rune(input.Text())
 	runeCount := map[rune]int{}
 
 	for hi := 0; hi < len(runes); hi++ {
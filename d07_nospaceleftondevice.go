@@ -2,11 +2,15 @@
 package adventofcode
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/bits"
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 
 	"golang.org/x/exp/maps"
 )
@@ -18,7 +22,11 @@ func (s NoSpaceLeftOnDevice) Details() Details {
 }
 
 func (s NoSpaceLeftOnDevice) Solve(input *Input) (Result, error) {
-	root, err := parseCommandsOutput(input)
+	return s.SolveStream(input.Reader())
+}
+
+func (s NoSpaceLeftOnDevice) SolveStream(r io.Reader) (Result, error) {
+	root, err := parseCommands(NewLineIterator(r))
 	if err != nil {
 		return Result{}, err
 	}
@@ -59,6 +67,200 @@ func part2SpaceToBeFreedUp(root *Dir) (int, error) {
 	return 0, fmt.Errorf("can't free up %d of disk space", toFreeUp)
 }
 
+// DeletionPlan is a set of files and directories, none nested in another,
+// whose deletion frees up enough disk space.
+type DeletionPlan struct {
+	Paths []string
+	Size  int
+}
+
+// PlanDeletion finds the entries whose deletion leaves at least the given
+// amount of free space while deleting as few bytes as possible. Unlike part
+// 2, the plan can combine several directories and, when includeFiles is set,
+// individual files.
+func (s NoSpaceLeftOnDevice) PlanDeletion(input *Input, freeSpace int, includeFiles bool) (DeletionPlan, error) {
+	root, err := parseCommandsOutput(input)
+	if err != nil {
+		return DeletionPlan{}, err
+	}
+	unused := 70000000 - dirSizes(root)["/"]
+	return planDeletion(root, freeSpace-unused, includeFiles)
+}
+
+// deletionCandidate is a file or directory that can be deleted. Candidates
+// are laid out in preorder, so the ones nested in a directory come right
+// after it and end at the index of its next sibling.
+type deletionCandidate struct {
+	path string
+	size int
+	end  int
+}
+
+func deletionCandidates(root *Dir, includeFiles bool) []deletionCandidate {
+	var candidates []deletionCandidate
+	var dfs func(*Dir) int
+	dfs = func(curr *Dir) int {
+		i := len(candidates)
+		candidates = append(candidates, deletionCandidate{path: curr.path()})
+		names := maps.Keys(curr.Entries)
+		sort.Strings(names)
+		size := 0
+		for _, name := range names {
+			switch e := curr.Entries[name].(type) {
+			case *File:
+				size += e.Size
+				if includeFiles {
+					path := strings.TrimSuffix(curr.path(), "/") + "/" + e.Name
+					candidates = append(candidates, deletionCandidate{path: path, size: e.Size, end: len(candidates) + 1})
+				}
+			case *Dir:
+				size += dfs(e)
+			}
+		}
+		candidates[i].size = size
+		candidates[i].end = len(candidates)
+		return size
+	}
+	dfs(root)
+	return candidates
+}
+
+// planDeletion solves the knapsack problem of picking the candidates that
+// add up to the smallest total of at least toFreeUp bytes. Walking the
+// candidates in preorder, each one is either deleted, skipping everything
+// nested in it, or kept. reach holds the totals below toFreeUp that can be
+// deleted so far. Deleting a candidate adds its size to the totals reachable
+// before it once the walk leaves it, so those are only kept aside for the
+// directories being walked. Each total remembers the candidate that first
+// reached it, from which the plan is rebuilt. This takes O(n*toFreeUp/64)
+// time and O(depth*toFreeUp/64 + toFreeUp) memory.
+func planDeletion(root *Dir, toFreeUp int, includeFiles bool) (DeletionPlan, error) {
+	if toFreeUp <= 0 {
+		return DeletionPlan{}, nil
+	}
+	candidates := deletionCandidates(root, includeFiles)
+	if toFreeUp > candidates[0].size {
+		return DeletionPlan{}, fmt.Errorf("can't free up %d of disk space", toFreeUp)
+	}
+
+	reach := newBitset(toFreeUp)
+	reach.set(0)
+	reachedBy := make([]int32, toFreeUp) // candidate that first reached each total
+	best, bestIdx := -1, 0
+	deleteCandidate := func(i int, before bitset) {
+		c := candidates[i]
+		if from := before.next(toFreeUp - c.size); from >= 0 && (best < 0 || from+c.size < best) {
+			best, bestIdx = from+c.size, i
+		}
+		reach.or(before, c.size, func(total int) { reachedBy[total] = int32(i) })
+	}
+
+	type walkedDir struct {
+		idx    int
+		before bitset // totals reachable before the directory
+	}
+	var walking []walkedDir
+	var spare []bitset
+	leave := func(i int) {
+		for len(walking) > 0 && candidates[walking[len(walking)-1].idx].end <= i {
+			dir := walking[len(walking)-1]
+			walking = walking[:len(walking)-1]
+			deleteCandidate(dir.idx, dir.before)
+			spare = append(spare, dir.before)
+		}
+	}
+	for i, c := range candidates {
+		leave(i)
+		if c.end == i+1 { // nothing nested in it
+			deleteCandidate(i, reach)
+			continue
+		}
+		var before bitset
+		if n := len(spare); n > 0 {
+			before, spare = spare[n-1], spare[:n-1]
+		} else {
+			before = newBitset(toFreeUp)
+		}
+		copy(before.words, reach.words)
+		walking = append(walking, walkedDir{idx: i, before: before})
+	}
+	leave(len(candidates))
+	if best < 0 {
+		return DeletionPlan{}, fmt.Errorf("can't free up %d of disk space", toFreeUp)
+	}
+
+	plan := DeletionPlan{Paths: []string{candidates[bestIdx].path}, Size: best}
+	for total := best - candidates[bestIdx].size; total > 0; {
+		c := candidates[reachedBy[total]]
+		plan.Paths = append(plan.Paths, c.path)
+		total -= c.size
+	}
+	sort.Strings(plan.Paths)
+	return plan, nil
+}
+
+// bitset is a fixed-size set of non-negative integers.
+type bitset struct {
+	words []uint64
+	size  int
+}
+
+func newBitset(size int) bitset {
+	return bitset{words: make([]uint64, (size+63)/64), size: size}
+}
+
+func (b bitset) set(i int) {
+	b.words[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) has(i int) bool {
+	return i >= 0 && i < b.size && b.words[i/64]&(1<<(i%64)) != 0
+}
+
+// or adds the integers of other shifted by delta, dropping those that don't
+// fit, and calls added with each one that wasn't in the set yet. other may
+// be b itself.
+func (b bitset) or(other bitset, delta int, added func(int)) {
+	if delta >= b.size {
+		return
+	}
+	shift, offset := delta/64, uint(delta%64)
+	for i := len(b.words) - 1; i >= shift; i-- {
+		w := other.words[i-shift] << offset
+		if offset > 0 && i-shift > 0 {
+			w |= other.words[i-shift-1] >> (64 - offset)
+		}
+		if extra := len(b.words)*64 - b.size; i == len(b.words)-1 && extra > 0 {
+			w &= ^uint64(0) >> extra
+		}
+		for n := w &^ b.words[i]; n != 0; n &= n - 1 {
+			added(i*64 + bits.TrailingZeros64(n))
+		}
+		b.words[i] |= w
+	}
+}
+
+// next returns the smallest integer in the set not less than i, or -1.
+func (b bitset) next(i int) int {
+	if i < 0 {
+		i = 0
+	}
+	for ; i < b.size; i++ {
+		if i%64 == 0 {
+			for i < b.size && b.words[i/64] == 0 {
+				i += 64
+			}
+			if i >= b.size {
+				break
+			}
+		}
+		if b.has(i) {
+			return i
+		}
+	}
+	return -1
+}
+
 func dirSizes(root *Dir) map[string]int {
 	sizes := map[string]int{}
 	var dfs func(string, *Dir) int
@@ -80,6 +282,116 @@ func dirSizes(root *Dir) map[string]int {
 	return sizes
 }
 
+// ExportFilesystem writes the filesystem reconstructed from the terminal
+// output in one of the following formats (tree and json also flag the
+// directories that were never listed):
+//   - "tree": hierarchy with sizes, like `tree -s --du`
+//   - "du": sizes of every file and directory sorted by size, like `du -ab | sort -rn`
+//   - "json": hierarchy as a JSON document
+func (s NoSpaceLeftOnDevice) ExportFilesystem(input *Input, format string, w io.Writer) error {
+	root, err := parseCommandsOutput(input)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "tree":
+		return exportTree(root, w)
+	case "du":
+		return exportDu(root, w)
+	case "json":
+		return exportJSON(root, w)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// fsNode is a snapshot of a file or directory (with its total size) used by
+// the exporters.
+type fsNode struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Size    int      `json:"size"`
+	Entries []fsNode `json:"entries,omitempty"`
+	// Unlisted is set for directories whose contents were never listed.
+	Unlisted bool `json:"unlisted,omitempty"`
+}
+
+func newFsNode(entry FsEntry) fsNode {
+	switch e := entry.(type) {
+	case *File:
+		return fsNode{Name: e.Name, Type: "file", Size: e.Size}
+	case *Dir:
+		node := fsNode{Name: e.Name, Type: "dir", Entries: []fsNode{}, Unlisted: !e.Listed}
+		for _, child := range e.Entries {
+			childNode := newFsNode(child)
+			node.Size += childNode.Size
+			node.Entries = append(node.Entries, childNode)
+		}
+		sort.Slice(node.Entries, func(i, j int) bool { return node.Entries[i].Name < node.Entries[j].Name })
+		return node
+	default:
+		panic(fmt.Sprintf("unexpected entry: %v", entry))
+	}
+}
+
+func (n fsNode) unlistedNote() string {
+	if n.Unlisted {
+		return " (not listed)"
+	}
+	return ""
+}
+
+func exportTree(root *Dir, w io.Writer) error {
+	node := newFsNode(root)
+	width := len(strconv.Itoa(node.Size))
+	var b strings.Builder
+	var walk func(fsNode, string)
+	walk = func(dir fsNode, indent string) {
+		for i, child := range dir.Entries {
+			branch, nextIndent := "├── ", "│   "
+			if i == len(dir.Entries)-1 {
+				branch, nextIndent = "└── ", "    "
+			}
+			fmt.Fprintf(&b, "%s%s[%*d]  %s%s\n", indent, branch, width, child.Size, child.Name, child.unlistedNote())
+			walk(child, indent+nextIndent)
+		}
+	}
+	fmt.Fprintf(&b, "[%*d]  %s%s\n", width, node.Size, node.Name, node.unlistedNote())
+	walk(node, "")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func exportDu(root *Dir, w io.Writer) error {
+	type usage struct {
+		path string
+		size int
+	}
+	var usages []usage
+	var walk func(fsNode, string)
+	walk = func(node fsNode, path string) {
+		usages = append(usages, usage{path, node.Size})
+		for _, child := range node.Entries {
+			walk(child, strings.TrimSuffix(path, "/")+"/"+child.Name)
+		}
+	}
+	walk(newFsNode(root), "/")
+	sort.SliceStable(usages, func(i, j int) bool { return usages[i].size > usages[j].size })
+
+	var b strings.Builder
+	for _, u := range usages {
+		fmt.Fprintf(&b, "%d\t%s\n", u.size, u.path)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func exportJSON(root *Dir, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newFsNode(root))
+}
+
 type FsEntry any
 
 type File struct {
@@ -92,54 +404,154 @@ type Dir struct {
 	Name    string
 	Entries map[string]FsEntry
 	Parent  *Dir
+	// Listed tells whether the contents of the directory were listed by ls.
+	// The size of a directory that wasn't (or that has a subdirectory that
+	// wasn't) is only a lower bound.
+	Listed bool
 }
 
-func (d *Dir) cd(dest string) (*Dir, error) {
-	switch dest {
-	case "/":
-		curr := d
-		for curr.Parent != nil {
+func (d *Dir) root() *Dir {
+	curr := d
+	for curr.Parent != nil {
+		curr = curr.Parent
+	}
+	return curr
+}
+
+func (d *Dir) path() string {
+	if d.Parent == nil {
+		return "/"
+	}
+	return strings.TrimSuffix(d.Parent.path(), "/") + "/" + d.Name
+}
+
+// cd returns the directory at the given path, which is either absolute or
+// relative to d and can have multiple segments (e.g. "../a/b"). Directories
+// not found in a directory that hasn't been listed yet are created, as they
+// may be listed later on.
+func (d *Dir) cd(path string) (*Dir, error) {
+	curr := d
+	if strings.HasPrefix(path, "/") {
+		curr = d.root()
+	}
+	for _, name := range strings.Split(path, "/") {
+		switch name {
+		case "", ".":
+		case "..":
+			if curr.Parent == nil {
+				return nil, errors.New("cannot go up another level")
+			}
 			curr = curr.Parent
+		default:
+			entry, ok := curr.Entries[name]
+			if !ok {
+				if curr.Listed {
+					return nil, fmt.Errorf("dir %s doesn't exist in %s", name, curr.path())
+				}
+				dir := &Dir{Name: name, Parent: curr, Entries: map[string]FsEntry{}}
+				curr.Entries[name] = dir
+				entry = dir
+			}
+			dir, ok := entry.(*Dir)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a directory", name)
+			}
+			curr = dir
+		}
+	}
+	return curr, nil
+}
+
+// add adds an entry listed by ls. If the directory was listed before, the
+// entry is merged with the existing one, unless they conflict.
+func (d *Dir) add(entry FsEntry) error {
+	switch e := entry.(type) {
+	case *Dir:
+		switch d.Entries[e.Name].(type) {
+		case nil:
+			d.Entries[e.Name] = e
+		case *File:
+			return fmt.Errorf("%s was previously listed as a file", e.Name)
 		}
-		return curr, nil
-	case "..":
-		if d.Parent != nil {
-			return d.Parent, nil
+	case *File:
+		switch existing := d.Entries[e.Name].(type) {
+		case nil:
+			d.Entries[e.Name] = e
+		case *Dir:
+			return fmt.Errorf("%s was previously listed as a directory", e.Name)
+		case *File:
+			if existing.Size != e.Size {
+				return fmt.Errorf("%s was previously listed with size %d", e.Name, existing.Size)
+			}
 		}
-		return nil, errors.New("cannot go up another level")
-	default:
-		if entry, ok := d.Entries[dest]; ok {
-			if dir, ok := entry.(*Dir); ok {
-				return dir, nil
+	}
+	return nil
+}
+
+// UnlistedDirs returns the paths of the directories whose contents were
+// never listed, hence whose sizes (and those of their ancestors) are lower
+// bounds.
+func (s NoSpaceLeftOnDevice) UnlistedDirs(input *Input) ([]string, error) {
+	root, err := parseCommandsOutput(input)
+	if err != nil {
+		return nil, err
+	}
+	return unlistedDirs(root), nil
+}
+
+func unlistedDirs(root *Dir) []string {
+	var result []string
+	var dfs func(*Dir)
+	dfs = func(curr *Dir) {
+		if !curr.Listed {
+			result = append(result, curr.path())
+		}
+		for _, entry := range curr.Entries {
+			if d, ok := entry.(*Dir); ok {
+				dfs(d)
 			}
-			return nil, fmt.Errorf("%s is not a directory", dest)
 		}
-		return nil, fmt.Errorf("dir %s doesn't exit", dest)
 	}
+	dfs(root)
+	sort.Strings(result)
+	return result
 }
 
 var (
-	cdRgx   = regexp.MustCompile(`^\$ cd (.+)$`)
-	lsRgx   = regexp.MustCompile(`^\$ ls$`)
-	dirRgx  = regexp.MustCompile(`^dir (.+)$`)
-	fileRgx = regexp.MustCompile(`^(\d+) (.+)$`)
+	commandRgx = regexp.MustCompile(`^\$ (\S+)`)
+	cdRgx      = regexp.MustCompile(`^\$ cd (.+)$`)
+	lsRgx      = regexp.MustCompile(`^\$ ls$`)
+	dirRgx     = regexp.MustCompile(`^dir (.+)$`)
+	fileRgx    = regexp.MustCompile(`^(\d+) (.+)$`)
 )
 
 func parseCommandsOutput(input *Input) (*Dir, error) {
+	return parseCommands(input.LineIterator())
+}
+
+func parseCommands(lines *Iterator) (*Dir, error) {
 	root := &Dir{Name: "/", Entries: map[string]FsEntry{}}
 	curr := root
-	lines := input.Lines()
-	i := 0
+	listing := false // whether the lines being read are the output of ls
 
-	for i < len(lines) {
-		line := lines[i]
-		i++
+	for lines.Next() {
+		line := lines.Text()
+		invalid := func(offset int, expected string) error {
+			return &ParseError{
+				Day:      NoSpaceLeftOnDevice{}.Details().Day,
+				Line:     lines.Line(),
+				Column:   column(line, offset),
+				Text:     line,
+				Expected: expected,
+			}
+		}
 
 		if cdRgx.MatchString(line) {
+			listing = false
 			groups := cdRgx.FindAllStringSubmatch(line, -1)
 			dest := groups[0][1]
 			if dir, err := curr.cd(dest); err != nil {
-				return nil, err
+				return nil, invalid(len("$ cd "), fmt.Sprintf("a reachable directory (%v)", err))
 			} else {
 				curr = dir
 				continue
@@ -147,29 +559,42 @@ func parseCommandsOutput(input *Input) (*Dir, error) {
 		}
 
 		if lsRgx.MatchString(line) {
-			for i < len(lines) {
-				lsOutputLine := lines[i]
-				if dirRgx.MatchString(lsOutputLine) {
-					groups := dirRgx.FindAllStringSubmatch(lsOutputLine, -1)
-					dir := groups[0][1]
-					curr.Entries[dir] = &Dir{Name: dir, Parent: curr, Entries: map[string]FsEntry{}}
-					i++
-					continue
-				}
-				if fileRgx.MatchString(lsOutputLine) {
-					groups := fileRgx.FindAllStringSubmatch(lsOutputLine, -1)
-					size, _ := strconv.Atoi(groups[0][1])
-					name := groups[0][2]
-					curr.Entries[name] = &File{Name: name, Size: size, Parent: curr}
-					i++
-					continue
-				}
-				break
+			listing = true
+			curr.Listed = true
+			continue
+		}
+
+		if groups := commandRgx.FindStringSubmatch(line); groups != nil {
+			return nil, invalid(len("$ "), fmt.Sprintf("a supported command (cd or ls), got %q", groups[1]))
+		}
+
+		if !listing {
+			return nil, invalid(0, "a command starting with '$ '")
+		}
+
+		if dirRgx.MatchString(line) {
+			groups := dirRgx.FindAllStringSubmatch(line, -1)
+			dir := groups[0][1]
+			if err := curr.add(&Dir{Name: dir, Parent: curr, Entries: map[string]FsEntry{}}); err != nil {
+				return nil, invalid(len("dir "), fmt.Sprintf("an entry consistent with previous listings (%v)", err))
+			}
+			continue
+		}
+
+		if fileRgx.MatchString(line) {
+			groups := fileRgx.FindAllStringSubmatch(line, -1)
+			size, err := strconv.Atoi(groups[0][1])
+			if err != nil {
+				return nil, invalid(0, "a file size")
+			}
+			name := groups[0][2]
+			if err := curr.add(&File{Name: name, Size: size, Parent: curr}); err != nil {
+				return nil, invalid(len(groups[0][1])+1, fmt.Sprintf("an entry consistent with previous listings (%v)", err))
 			}
 			continue
 		}
-		return nil, fmt.Errorf("line %d is invalid: %s", i, line)
+		return nil, invalid(0, "an entry listed by ls, such as 'dir a' or '14848514 b.txt'")
 	}
 
-	return root, nil
+	return root, lines.Err()
 }
@@ -4,7 +4,13 @@ package adventofcode
 import (
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
 	"strconv"
+	"strings"
 )
 
 type TreetopTreeHouse struct{}
@@ -26,6 +32,109 @@ func (p TreetopTreeHouse) Solve(input *Input) (Result, error) {
 	}, nil
 }
 
+// Render draws a heatmap of the scenic scores as a PNG image, with the tree
+// with the highest score in red.
+func (p TreetopTreeHouse) Render(input *Input, w io.Writer) error {
+	heights, err := parseTreeHeights(input)
+	if err != nil {
+		return err
+	}
+	return p.renderScenicScores(heights.ScenicScores(), 1000, w)
+}
+
+// RenderVisibility writes a map of the trees showing the height of the
+// visible ones, a dot for the hidden ones and a * for the one with the
+// highest scenic score, followed by a summary.
+func (p TreetopTreeHouse) RenderVisibility(input *Input, w io.Writer) error {
+	heights, err := parseTreeHeights(input)
+	if err != nil {
+		return err
+	}
+	visibility := heights.VisibleTrees()
+	scores := heights.ScenicScores()
+
+	var b strings.Builder
+	for r, row := range heights {
+		for c, height := range row {
+			switch {
+			case r == scores.BestRow && c == scores.BestCol:
+				b.WriteByte('*')
+			case visibility.Visible[r][c]:
+				b.WriteByte(byte('0' + height))
+			default:
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "%d of %d trees are visible; the highest scenic score is %d (row %d, column %d)\n",
+		visibility.Count, heights.Height()*heights.Width(), scores.Max, scores.BestRow+1, scores.BestCol+1)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	// heatmapColors are the stops of the gradient from the lowest to the
+	// highest scenic score.
+	heatmapColors = []color.RGBA{
+		{R: 0x44, G: 0x01, B: 0x54, A: 0xff},
+		{R: 0x3b, G: 0x52, B: 0x8b, A: 0xff},
+		{R: 0x21, G: 0x91, B: 0x8c, A: 0xff},
+		{R: 0x5e, G: 0xc9, B: 0x62, A: 0xff},
+		{R: 0xfd, G: 0xe7, B: 0x25, A: 0xff},
+	}
+	bestTreeColor = color.RGBA{R: 0xff, A: 0xff}
+)
+
+// renderScenicScores draws each tree as a square of the heatmap, whose
+// longest side is at most maxSize pixels (unless there are more trees than
+// that). Colors follow the logarithm of the scores, which span several
+// orders of magnitude.
+func (p TreetopTreeHouse) renderScenicScores(scores ScenicScores, maxSize int, w io.Writer) error {
+	height := len(scores.Scores)
+	if height == 0 || len(scores.Scores[0]) == 0 {
+		return errors.New("no trees to render")
+	}
+	width := len(scores.Scores[0])
+	size := maxSize / width
+	if s := maxSize / height; s < size {
+		size = s
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width*size, height*size))
+	for r, row := range scores.Scores {
+		for c, score := range row {
+			col := heatmapColor(score, scores.Max)
+			if r == scores.BestRow && c == scores.BestCol {
+				col = bestTreeColor
+			}
+			for y := r * size; y < (r+1)*size; y++ {
+				for x := c * size; x < (c+1)*size; x++ {
+					img.SetRGBA(x, y, col)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+func heatmapColor(score, max int) color.RGBA {
+	if max == 0 {
+		return heatmapColors[0]
+	}
+	t := math.Log1p(float64(score)) / math.Log1p(float64(max)) * float64(len(heatmapColors)-1)
+	i := int(t)
+	if i >= len(heatmapColors)-1 {
+		return heatmapColors[len(heatmapColors)-1]
+	}
+	from, to, f := heatmapColors[i], heatmapColors[i+1], t-float64(i)
+	blend := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*f) }
+	return color.RGBA{R: blend(from.R, to.R), G: blend(from.G, to.G), B: blend(from.B, to.B), A: 0xff}
+}
+
 type TreeHeights [][]int
 
 func (m TreeHeights) Height() int {
@@ -39,8 +148,115 @@ func (m TreeHeights) Width() int {
 	return len(m[0])
 }
 
-// TODO good use case for dynamic programming
+// VisibleTrees finds the trees visible from outside the grid in O(n²) time.
+// A tree is visible when it's taller than all the trees in some direction,
+// which is the running maximum of the heights coming from that edge.
 func (m TreeHeights) VisibleTrees() VisibilityMap {
+	visibilityMap := make([][]bool, m.Height())
+	for r := range visibilityMap {
+		visibilityMap[r] = make([]bool, m.Width())
+	}
+	m.scanLines(func(line []treePos) {
+		tallest := -1 // shorter than any tree, so trees on the edge are visible
+		for _, pos := range line {
+			if height := m.at(pos); height > tallest {
+				visibilityMap[pos.r][pos.c] = true
+				tallest = height
+			}
+		}
+	})
+
+	count := 0
+	for _, row := range visibilityMap {
+		for _, visible := range row {
+			if visible {
+				count++
+			}
+		}
+	}
+	return VisibilityMap{visibilityMap, count}
+}
+
+// ScenicScores computes the scenic score of every tree in O(n²) time. The
+// viewing distance of a tree in some direction reaches the closest tree at
+// least as tall, which is found with a stack of the trees seen so far that
+// aren't blocked by a taller tree after them.
+func (m TreeHeights) ScenicScores() ScenicScores {
+	scores := make([][]int, m.Height())
+	for r := range scores {
+		scores[r] = make([]int, m.Width())
+		for c := range scores[r] {
+			scores[r][c] = 1
+		}
+	}
+	m.scanLines(func(line []treePos) {
+		var stack []int // indexes in line of trees in decreasing order of height
+		for i, pos := range line {
+			height := m.at(pos)
+			for len(stack) > 0 && m.at(line[stack[len(stack)-1]]) < height {
+				stack = stack[:len(stack)-1]
+			}
+			distance := i // up to the edge
+			if len(stack) > 0 {
+				distance = i - stack[len(stack)-1]
+			}
+			scores[pos.r][pos.c] *= distance
+			stack = append(stack, i)
+		}
+	})
+
+	result := ScenicScores{Scores: scores}
+	for r, row := range scores {
+		for c, score := range row {
+			if score > result.Max {
+				result.Max, result.BestRow, result.BestCol = score, r, c
+			}
+		}
+	}
+	return result
+}
+
+type treePos struct {
+	r, c int
+}
+
+func (m TreeHeights) at(pos treePos) int {
+	return m[pos.r][pos.c]
+}
+
+// scanLines calls scan with the positions of every row and column of trees
+// in both directions: left to right, right to left, top to bottom and bottom
+// to top.
+func (m TreeHeights) scanLines(scan func(line []treePos)) {
+	h, w := m.Height(), m.Width()
+	for r := 0; r < h; r++ {
+		line := make([]treePos, w)
+		for c := range line {
+			line[c] = treePos{r, c}
+		}
+		scan(line)
+		scan(reverseLine(line))
+	}
+	for c := 0; c < w; c++ {
+		line := make([]treePos, h)
+		for r := range line {
+			line[r] = treePos{r, c}
+		}
+		scan(line)
+		scan(reverseLine(line))
+	}
+}
+
+func reverseLine(line []treePos) []treePos {
+	for i, j := 0, len(line)-1; i < j; i, j = i+1, j-1 {
+		line[i], line[j] = line[j], line[i]
+	}
+	return line
+}
+
+// visibleTreesBruteForce looks for the tallest tree in every direction of
+// every tree, in O(n³) time. It's kept to cross-check VisibleTrees.
+func (m TreeHeights) visibleTreesBruteForce() VisibilityMap {
 	var tallestTree func(int, int, int, int) int
 	tallestTree = func(r, c, rstep, cstep int) int {
 		if r < 0 || r >= m.Height() || c < 0 || c >= m.Width() {
@@ -77,7 +293,9 @@ func (m TreeHeights) VisibleTrees() VisibilityMap {
 	return VisibilityMap{visibilityMap, count}
 }
 
-func (m TreeHeights) ScenicScores() ScenicScores {
+// scenicScoresBruteForce walks every direction of every tree until the view
+// is blocked, in O(n³) time. It's kept to cross-check ScenicScores.
+func (m TreeHeights) scenicScoresBruteForce() ScenicScores {
 	var distance func(int, int, int, int, int) int
 	distance = func(height, r, c, rstep, cstep int) int {
 		if r+rstep < 0 || r+rstep >= m.Height() || c+cstep < 0 || c+cstep >= m.Width() {
@@ -89,8 +307,8 @@ func (m TreeHeights) ScenicScores() ScenicScores {
 		return 1 + distance(height, r+rstep, c+cstep, rstep, cstep)
 	}
 
-	max := 0
-	scores := make([][]int, m.Height())
+	result := ScenicScores{Scores: make([][]int, m.Height())}
+	scores := result.Scores
 	for r := 0; r < m.Height(); r++ {
 		scores[r] = make([]int, m.Width())
 		for c := 0; c < m.Width(); c++ {
@@ -101,12 +319,12 @@ func (m TreeHeights) ScenicScores() ScenicScores {
 					distance(height, r, c, 0, -1) * // left
 					distance(height, r, c, 0, 1) // right
 			scores[r][c] = score
-			if score > max {
-				max = score
+			if score > result.Max {
+				result.Max, result.BestRow, result.BestCol = score, r, c
 			}
 		}
 	}
-	return ScenicScores{scores, max}
+	return result
 }
 
 type VisibilityMap struct {
@@ -117,25 +335,48 @@ type VisibilityMap struct {
 type ScenicScores struct {
 	Scores [][]int
 	Max    int
+	// BestRow and BestCol locate the first tree, row by row, with the
+	// highest score.
+	BestRow, BestCol int
 }
 
 func parseTreeHeights(input *Input) (TreeHeights, error) {
 	lines := input.Lines()
 	height := len(lines)
-	if height == 0 {
-		return nil, errors.New("empty input")
-	}
 	width := len(lines[0])
+	if width == 0 {
+		return nil, &ParseError{
+			Day:      TreetopTreeHouse{}.Details().Day,
+			Line:     1,
+			Expected: "a row of trees",
+		}
+	}
 	forest := make(TreeHeights, height)
 	for r, line := range lines {
-		if width == 0 || len(line) != width {
-			return nil, fmt.Errorf("line %d has invalid width: %s", r, line)
+		if len(line) != width {
+			col := len(line)
+			if width < col {
+				col = width
+			}
+			return nil, &ParseError{
+				Day:      TreetopTreeHouse{}.Details().Day,
+				Line:     r + 1,
+				Column:   col + 1,
+				Text:     line,
+				Expected: fmt.Sprintf("a row of %d trees", width),
+			}
 		}
 		forest[r] = make([]int, width)
 		for c, tree := range line {
 			treeHeight, err := strconv.Atoi(string(tree))
 			if err != nil {
-				return nil, err
+				return nil, &ParseError{
+					Day:      TreetopTreeHouse{}.Details().Day,
+					Line:     r + 1,
+					Column:   column(line, c),
+					Text:     line,
+					Expected: "a tree height (0-9)",
+				}
 			}
 			forest[r][c] = treeHeight
 		}
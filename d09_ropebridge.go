@@ -3,9 +3,11 @@ package adventofcode
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 type RopeBridge struct{}
@@ -20,8 +22,8 @@ func (p RopeBridge) Solve(input *Input) (Result, error) {
 		return Result{}, err
 	}
 	return Result{
-		Part1: strconv.Itoa(countPositionsVisitedByTail(2, motions)),
-		Part2: strconv.Itoa(countPositionsVisitedByTail(10, motions)),
+		Part1: strconv.Itoa(countPositionsVisitedByTail(2, motions, ChebyshevFollow)),
+		Part2: strconv.Itoa(countPositionsVisitedByTail(10, motions, ChebyshevFollow)),
 	}, nil
 }
 
@@ -40,6 +42,41 @@ func (r Rope) tail() Knot {
 	return r[len(r)-1]
 }
 
+// step moves the head of the rope by delta, then every other knot follows
+// the one ahead of it until they touch again, which may take several moves
+// when the head moves further than one position. visit, if not nil, is
+// called with every position the tail moves to.
+func (r Rope) step(delta Delta, rule FollowRule, visit func(Knot)) {
+	r[0] = r[0].move(delta)
+	if len(r) == 1 && visit != nil {
+		visit(r[0])
+	}
+	for k := 1; k < len(r); k++ {
+		if r[k].touches(r[k-1], rule) {
+			return // the knots behind don't move either
+		}
+		for !r[k].touches(r[k-1], rule) {
+			r[k] = r[k].follow(r[k-1], rule)
+			if k == len(r)-1 && visit != nil {
+				visit(r[k])
+			}
+		}
+	}
+}
+
+// FollowRule tells when a knot touches the one ahead of it and how it moves
+// closer when it doesn't.
+type FollowRule int
+
+const (
+	// ChebyshevFollow lets knots touch and move diagonally, as in the puzzle.
+	ChebyshevFollow FollowRule = iota
+	// ManhattanFollow only lets knots touch and move horizontally or
+	// vertically. A knot as far behind horizontally as vertically moves
+	// vertically.
+	ManhattanFollow
+)
+
 type Knot struct {
 	X, Y int
 }
@@ -53,6 +90,25 @@ func (p Knot) isAdjacent(that Knot) bool {
 	return math.Abs(float64(delta.X)) <= 1 && math.Abs(float64(delta.Y)) <= 1
 }
 
+func (p Knot) touches(that Knot, rule FollowRule) bool {
+	if rule == ManhattanFollow {
+		delta := p.delta(that)
+		return math.Abs(float64(delta.X))+math.Abs(float64(delta.Y)) <= 1
+	}
+	return p.isAdjacent(that)
+}
+
+func (p Knot) follow(that Knot, rule FollowRule) Knot {
+	if rule == ManhattanFollow {
+		delta := p.delta(that)
+		if math.Abs(float64(delta.X)) >= math.Abs(float64(delta.Y)) {
+			return p.move(Delta{X: int(math.Max(-1, math.Min(1, float64(delta.X))))})
+		}
+		return p.move(Delta{Y: int(math.Max(-1, math.Min(1, float64(delta.Y))))})
+	}
+	return p.moveCloser(that)
+}
+
 func (p Knot) move(delta Delta) Knot {
 	return Knot{X: p.X + delta.X, Y: p.Y + delta.Y}
 }
@@ -70,34 +126,201 @@ func (p Knot) String() string {
 	return fmt.Sprintf("(%d,%d)", p.X, p.Y)
 }
 
-func countPositionsVisitedByTail(knots int, motions []Motion) int {
+func countPositionsVisitedByTail(knots int, motions []Motion, rule FollowRule) int {
 	rope := makeRope(knots)
-	visited := make(map[string]bool)
-	visit := func(k Knot) { visited[k.String()] = true }
+	visited := make(map[Knot]struct{})
+	visit := func(k Knot) { visited[k] = struct{}{} }
 	visit(rope.tail())
 
 	for _, motion := range motions {
-	sloop:
 		for step := 0; step < motion.Steps; step++ {
-			// move head
-			rope[0] = rope[0].move(motion.Dir)
-
-			// move remaining knots if needed
-			for k := 1; k < knots; k++ {
-				curr := rope[k]
-				prev := rope[k-1]
-
-				if curr.isAdjacent(prev) {
-					continue sloop
-				}
-				rope[k] = curr.moveCloser(prev)
-			}
-			visit(rope.tail())
+			rope.step(motion.Dir, rule, visit)
 		}
 	}
 	return len(visited)
 }
 
+// RopeSimulation records where every knot of a rope is after each step of
+// the motions.
+type RopeSimulation struct {
+	motions []Motion
+	// steps holds the rope before the first step and after each one.
+	steps []Rope
+	// tailVisits holds the positions the tail moved to during each step,
+	// which may be several when the knots ahead move diagonally, the first
+	// one being the initial position.
+	tailVisits [][]Knot
+	// min and max are the corners of the box bounding every position taken
+	// by the knots.
+	min, max Knot
+}
+
+// Simulate moves a rope with the given number of knots as the input says,
+// following the given rule, and records every step.
+func (p RopeBridge) Simulate(input *Input, knots int, rule FollowRule) (*RopeSimulation, error) {
+	if knots < 1 {
+		return nil, fmt.Errorf("invalid number of knots: %d", knots)
+	}
+	motions, err := parseMotions(input)
+	if err != nil {
+		return nil, err
+	}
+	return simulateRope(knots, motions, rule), nil
+}
+
+func simulateRope(knots int, motions []Motion, rule FollowRule) *RopeSimulation {
+	rope := makeRope(knots)
+	sim := &RopeSimulation{motions: motions, steps: []Rope{rope}, tailVisits: [][]Knot{{rope.tail()}}}
+	for _, motion := range motions {
+		for step := 0; step < motion.Steps; step++ {
+			next := make(Rope, knots)
+			copy(next, rope)
+			var visits []Knot
+			next.step(motion.Dir, rule, func(k Knot) { visits = append(visits, k) })
+			sim.steps = append(sim.steps, next)
+			sim.tailVisits = append(sim.tailVisits, visits)
+			rope = next
+		}
+	}
+	for _, rope := range sim.steps {
+		for _, k := range rope {
+			sim.extend(k)
+		}
+	}
+	for _, visits := range sim.tailVisits {
+		for _, k := range visits {
+			sim.extend(k)
+		}
+	}
+	return sim
+}
+
+func (s *RopeSimulation) extend(k Knot) {
+	if k.X < s.min.X {
+		s.min.X = k.X
+	}
+	if k.Y < s.min.Y {
+		s.min.Y = k.Y
+	}
+	if k.X > s.max.X {
+		s.max.X = k.X
+	}
+	if k.Y > s.max.Y {
+		s.max.Y = k.Y
+	}
+}
+
+// Steps returns the number of steps of the simulation.
+func (s *RopeSimulation) Steps() int {
+	return len(s.steps) - 1
+}
+
+// Rope returns the rope after the given step, 0 being the initial one.
+func (s *RopeSimulation) Rope(step int) (Rope, error) {
+	if step < 0 || step > s.Steps() {
+		return nil, fmt.Errorf("step %d out of range [0, %d]", step, s.Steps())
+	}
+	return s.steps[step], nil
+}
+
+// Trajectory returns the positions of the given knot (0 being the head)
+// before the first step and after each one.
+func (s *RopeSimulation) Trajectory(knot int) ([]Knot, error) {
+	if knot < 0 || knot >= len(s.steps[0]) {
+		return nil, fmt.Errorf("knot %d out of range [0, %d)", knot, len(s.steps[0]))
+	}
+	result := make([]Knot, len(s.steps))
+	for i, rope := range s.steps {
+		result[i] = rope[knot]
+	}
+	return result, nil
+}
+
+// Grid draws the rope after the given step like the puzzle does: H is the
+// head, then the knots are numbered (or T is the tail of a rope with 2
+// knots), s is the starting position and knots in front cover those behind.
+func (s *RopeSimulation) Grid(step int) (string, error) {
+	rope, err := s.Rope(step)
+	if err != nil {
+		return "", err
+	}
+	grid := s.emptyGrid()
+	for k := len(rope) - 1; k >= 0; k-- {
+		grid[rope[k].X-s.min.X][rope[k].Y-s.min.Y] = knotSymbol(k, len(rope))
+	}
+	return renderRopeGrid(grid), nil
+}
+
+// VisitedGrid draws the positions visited by the tail up to the given step
+// with #, s being the starting position. These include the positions the
+// tail moved through during a step, not only where it ended up.
+func (s *RopeSimulation) VisitedGrid(step int) (string, error) {
+	if _, err := s.Rope(step); err != nil {
+		return "", err
+	}
+	grid := s.emptyGrid()
+	for _, visits := range s.tailVisits[:step+1] {
+		for _, tail := range visits {
+			if tail != (Knot{}) {
+				grid[tail.X-s.min.X][tail.Y-s.min.Y] = '#'
+			}
+		}
+	}
+	return renderRopeGrid(grid), nil
+}
+
+// ExportFrames writes the grid after each motion, headed by the motion like
+// in the puzzle, or after each step of the motions if perStep is set.
+func (s *RopeSimulation) ExportFrames(w io.Writer, perStep bool) error {
+	var b strings.Builder
+	grid, _ := s.Grid(0)
+	fmt.Fprintf(&b, "== Initial State ==\n\n%s", grid)
+	step := 0
+	for _, motion := range s.motions {
+		fmt.Fprintf(&b, "\n== %v ==\n", motion)
+		for i := 0; i < motion.Steps; i++ {
+			step++
+			if perStep || i == motion.Steps-1 {
+				grid, _ := s.Grid(step)
+				fmt.Fprintf(&b, "\n%s", grid)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (s *RopeSimulation) emptyGrid() [][]byte {
+	grid := make([][]byte, s.max.X-s.min.X+1)
+	for i := range grid {
+		grid[i] = []byte(strings.Repeat(".", s.max.Y-s.min.Y+1))
+	}
+	grid[-s.min.X][-s.min.Y] = 's'
+	return grid
+}
+
+func knotSymbol(k, knots int) byte {
+	switch {
+	case k == 0:
+		return 'H'
+	case knots == 2:
+		return 'T'
+	case k <= 9:
+		return byte('0' + k)
+	default:
+		return '*'
+	}
+}
+
+func renderRopeGrid(grid [][]byte) string {
+	var b strings.Builder
+	for _, row := range grid {
+		b.Write(row)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
 func makeRope(knots int) Rope {
 	rope := make([]Knot, knots)
 	for i := 0; i < knots; i++ {
@@ -106,24 +329,62 @@ func makeRope(knots int) Rope {
 	return rope
 }
 
-var motionRgx = regexp.MustCompile(`^([LRUD]) (\d+)$`)
+// String returns the motion as written in the input.
+func (m Motion) String() string {
+	for dir, delta := range motionDeltas {
+		if delta == m.Dir {
+			return fmt.Sprintf("%s %d", dir, m.Steps)
+		}
+	}
+	return fmt.Sprintf("%d,%d %d", m.Dir.Y, -m.Dir.X, m.Steps)
+}
+
+// motionDeltas holds the deltas of the named directions. Knot.X grows
+// downwards and Knot.Y rightwards.
+var motionDeltas = map[string]Delta{
+	"R":  {0, 1},
+	"L":  {0, -1},
+	"U":  {-1, 0},
+	"D":  {1, 0},
+	"UL": {-1, -1},
+	"UR": {-1, 1},
+	"DL": {1, -1},
+	"DR": {1, 1},
+}
+
+// motionRgx matches a named direction or a vector x,y (with y growing
+// upwards, so 1,1 is the same as UR) and a number of steps.
+var motionRgx = regexp.MustCompile(`^([UD][LR]?|[LR]|(-?\d+),(-?\d+)) (\d+)$`)
 
 func parseMotions(input *Input) ([]Motion, error) {
 	lines := input.Lines()
 	result := make([]Motion, len(lines))
-	deltas := map[string]Delta{
-		"R": {0, 1},
-		"L": {0, -1},
-		"U": {-1, 0},
-		"D": {1, 0},
-	}
 	for i, line := range lines {
+		invalid := &ParseError{
+			Day:      RopeBridge{}.Details().Day,
+			Line:     i + 1,
+			Text:     line,
+			Expected: "a direction (U, D, L, R, UL, UR, DL, DR or a vector such as 2,-1) and a number of steps separated by a space",
+		}
 		if !motionRgx.MatchString(line) {
-			return nil, fmt.Errorf("invalid line: %s", line)
+			return nil, invalid
 		}
 		groups := motionRgx.FindAllStringSubmatch(line, -1)
-		delta := deltas[groups[0][1]]
-		steps, _ := strconv.Atoi(groups[0][2])
+		delta, ok := motionDeltas[groups[0][1]]
+		if !ok {
+			x, errX := strconv.Atoi(groups[0][2])
+			y, errY := strconv.Atoi(groups[0][3])
+			if errX != nil || errY != nil {
+				invalid.Expected = "a vector within range"
+				return nil, invalid
+			}
+			delta = Delta{X: -y, Y: x}
+		}
+		steps, err := strconv.Atoi(groups[0][4])
+		if err != nil {
+			invalid.Expected = "a number of steps within range"
+			return nil, invalid
+		}
 		result[i] = Motion{Dir: delta, Steps: steps}
 	}
 	return result, nil
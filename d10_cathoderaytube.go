@@ -3,7 +3,6 @@ package adventofcode
 
 import (
 	"bytes"
-	"fmt"
 	"regexp"
 	"strconv"
 )
@@ -75,7 +74,7 @@ var (
 func (p CathodeRayTube) parseInstructions(input *Input) ([]Add, error) {
 	var result []Add
 
-	for _, line := range input.Lines() {
+	for i, line := range input.Lines() {
 		result = append(result, Add{0})
 		switch {
 		case noopRgx.MatchString(line):
@@ -84,7 +83,12 @@ func (p CathodeRayTube) parseInstructions(input *Input) ([]Add, error) {
 			value, _ := strconv.Atoi(groups[0][1])
 			result = append(result, Add{value})
 		default:
-			return nil, fmt.Errorf("invalid line: %s", line)
+			return nil, &ParseError{
+				Day:      p.Details().Day,
+				Line:     i + 1,
+				Text:     line,
+				Expected: "a noop or addx instruction",
+			}
 		}
 	}
 	return result, nil
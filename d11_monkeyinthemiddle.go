@@ -2,7 +2,11 @@
 package adventofcode
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"regexp"
 	"sort"
 	"strconv"
@@ -16,11 +20,19 @@ func (p MonkeyInTheMiddle) Details() Details {
 }
 
 func (p MonkeyInTheMiddle) Solve(input *Input) (Result, error) {
-	part1, err := p.solve(20, p.divBy3Relief, input)
+	return p.SolveStream(input.Reader())
+}
+
+func (p MonkeyInTheMiddle) SolveStream(r io.Reader) (Result, error) {
+	monkeys, err := p.readNotes(NewParagraphIterator(r))
+	if err != nil {
+		return Result{}, err
+	}
+	part1, err := p.solve(20, p.divBy3Relief, monkeys)
 	if err != nil {
 		return Result{}, err
 	}
-	part2, err := p.solve(10000, p.modByDivisorsRelief, input)
+	part2, err := p.solve(10000, p.modByDivisorsRelief, monkeys)
 	if err != nil {
 		return Result{}, err
 	}
@@ -29,33 +41,126 @@ func (p MonkeyInTheMiddle) Solve(input *Input) (Result, error) {
 
 type MonkeyId string
 type WorryLevel int
-type Inspect func(wl WorryLevel) WorryLevel
+type Inspect func(wl WorryLevel) (WorryLevel, error)
 type DecideNext func(wl WorryLevel) MonkeyId
-type ReliefMaker func(monkeys []*Monkey) Relief
-type Relief func(wl WorryLevel) WorryLevel
+type ReliefMaker func(monkeys []*Monkey) (Relief, error)
+
+// Relief lowers the worry level of an item after it's inspected. Each relief
+// can be applied to both regular and arbitrary-precision worry levels.
+type Relief interface {
+	reduce(wl WorryLevel) WorryLevel
+	reduceBig(wl *big.Int) *big.Int
+	// describe returns how the relief is narrated, or "" if it does nothing.
+	describe() string
+}
 
 type Monkey struct {
-	id      MonkeyId
-	items   []WorryLevel
-	divisor int
-	inspect Inspect
-	next    DecideNext
+	id                  MonkeyId
+	items               []WorryLevel
+	divisor             int
+	operation           opExpr
+	inspect             Inspect
+	next                DecideNext
+	whenTrue, whenFalse MonkeyId
 }
 
-func (p MonkeyInTheMiddle) solve(rounds int, rm ReliefMaker, input *Input) (string, error) {
-	monkeys, err := p.parseNotes(input)
+// WorryOverflowError reports an inspection whose resulting worry level
+// doesn't fit in a WorryLevel.
+type WorryOverflowError struct {
+	Round  int // 1-based
+	Monkey MonkeyId
+	Worry  WorryLevel // worry level of the item before the inspection
+}
+
+func (e *WorryOverflowError) Error() string {
+	return fmt.Sprintf("worry level overflow on round %d: monkey %s inspecting an item with worry level %d", e.Round, e.Monkey, e.Worry)
+}
+
+var errWorryOverflow = errors.New("worry level overflow")
+
+// MonkeySimulation summarises the result of simulating a number of rounds.
+type MonkeySimulation struct {
+	MonkeyBusiness int
+	// Overflow is set when the worry levels didn't fit in a WorryLevel, in
+	// which case the simulation was carried out with arbitrary precision.
+	Overflow *WorryOverflowError
+}
+
+func (p MonkeyInTheMiddle) solve(rounds int, rm ReliefMaker, monkeys []*Monkey) (string, error) {
+	sim, err := p.simulate(rounds, rm, monkeys, nil)
 	if err != nil {
 		return "", err
 	}
-	counts, err := p.processRounds(rounds, rm, monkeys)
+	return strconv.Itoa(sim.MonkeyBusiness), nil
+}
+
+// SimulateWithoutRelief simulates the given number of rounds without lowering
+// the worry levels after each inspection. Note that worry levels can grow
+// exponentially, so this is only practical for a small number of rounds.
+func (p MonkeyInTheMiddle) SimulateWithoutRelief(input *Input, rounds int) (MonkeySimulation, error) {
+	monkeys, err := p.parseNotes(input)
 	if err != nil {
-		return "", err
+		return MonkeySimulation{}, err
 	}
-	monkeyBusinessLevel, err := p.calcMonkeyBusinessLevel(counts)
+	return p.simulate(rounds, p.noRelief, monkeys, nil)
+}
+
+// Trace simulates the given number of rounds (with or without relief),
+// reporting every step to the tracer. Unlike the other simulations, tracing
+// doesn't fall back to arbitrary precision: it stops with a
+// WorryOverflowError instead.
+func (p MonkeyInTheMiddle) Trace(input *Input, rounds int, relief bool, tracer MonkeyTracer) (MonkeySimulation, error) {
+	monkeys, err := p.parseNotes(input)
 	if err != nil {
-		return "", err
+		return MonkeySimulation{}, err
+	}
+	rm := p.divBy3Relief
+	if !relief {
+		rm = p.noRelief
+	}
+	return p.simulate(rounds, rm, monkeys, tracer)
+}
+
+// perItemRounds is the number of rounds from which simulate follows items
+// individually rather than round by round (see processRoundsPerItem).
+const perItemRounds = 10_000
+
+// simulate processes the rounds with regular worry levels, falling back to
+// arbitrary precision if they overflow (unless tracing). Long simulations
+// follow the items individually, except when tracing, since the narrative
+// follows the monkeys. The items held by the monkeys are left untouched.
+func (p MonkeyInTheMiddle) simulate(rounds int, rm ReliefMaker, monkeys []*Monkey, tracer MonkeyTracer) (MonkeySimulation, error) {
+	var sim MonkeySimulation
+	var counts map[MonkeyId]int
+	var err error
+	if tracer == nil && rounds >= perItemRounds {
+		counts, err = p.processManyRounds(rounds, rm, cloneMonkeys(monkeys))
+	} else {
+		counts, err = p.processRounds(rounds, rm, cloneMonkeys(monkeys), tracer)
+	}
+	if errors.As(err, &sim.Overflow) && tracer == nil {
+		counts, err = p.processRoundsBig(rounds, rm, monkeys)
+	}
+	if err != nil {
+		return MonkeySimulation{}, err
+	}
+	sim.MonkeyBusiness, err = p.calcMonkeyBusinessLevel(counts)
+	if err != nil {
+		return MonkeySimulation{}, err
+	}
+	return sim, nil
+}
+
+// cloneMonkeys returns copies of the monkeys holding copies of their items,
+// as processRounds moves the items around.
+func cloneMonkeys(monkeys []*Monkey) []*Monkey {
+	result := make([]*Monkey, len(monkeys))
+	for i, monkey := range monkeys {
+		clone := *monkey
+		clone.items = append([]WorryLevel(nil), monkey.items...)
+		result[i] = &clone
 	}
-	return strconv.Itoa(monkeyBusinessLevel), nil
+	return result
 }
 
 func (p MonkeyInTheMiddle) calcMonkeyBusinessLevel(inspections map[MonkeyId]int) (int, error) {
@@ -67,28 +172,53 @@ func (p MonkeyInTheMiddle) calcMonkeyBusinessLevel(inspections map[MonkeyId]int)
 		counts = append(counts, count)
 	}
 	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+	if counts[1] > 0 && counts[0] > math.MaxInt/counts[1] {
+		return 0, fmt.Errorf("monkey business level overflows: %d * %d", counts[0], counts[1])
+	}
 	return counts[0] * counts[1], nil
 }
 
-func (p MonkeyInTheMiddle) processRounds(rounds int, rm ReliefMaker, monkeys []*Monkey) (map[MonkeyId]int, error) {
-	monkeysById := map[MonkeyId]*Monkey{}
-	inspections := map[MonkeyId]int{}
-	for _, monkey := range monkeys {
-		if _, ok := monkeysById[monkey.id]; ok {
-			return nil, fmt.Errorf("duplicate monkey id: %s", monkey.id)
-		}
-		monkeysById[monkey.id] = monkey
-		inspections[monkey.id] = 0
+// processRounds simulates the rounds, reporting each step to the tracer if
+// it isn't nil.
+func (p MonkeyInTheMiddle) processRounds(rounds int, rm ReliefMaker, monkeys []*Monkey, tracer MonkeyTracer) (map[MonkeyId]int, error) {
+	monkeysById, err := p.indexMonkeys(monkeys)
+	if err != nil {
+		return nil, err
+	}
+	inspections := p.initInspections(monkeys)
+	relief, err := rm(monkeys)
+	if err != nil {
+		return nil, err
 	}
-	reliefFn := rm(monkeys)
 
-	for round := 0; round < rounds; round++ {
+	for round := 1; round <= rounds; round++ {
 		for _, monkey := range monkeys {
+			if tracer != nil {
+				tracer.Turn(round, monkey.id)
+			}
 			items := monkey.items
 			monkey.items = nil
 			for _, wl := range items {
-				newWl := reliefFn(monkey.inspect(wl))
+				if tracer != nil {
+					tracer.Inspect(wl)
+				}
+				inspected, err := monkey.inspect(wl)
+				if errors.Is(err, errWorryOverflow) {
+					return nil, &WorryOverflowError{Round: round, Monkey: monkey.id, Worry: wl}
+				}
+				if err != nil {
+					return nil, fmt.Errorf("monkey %s inspecting an item with worry level %d: %w", monkey.id, wl, err)
+				}
+				newWl := relief.reduce(inspected)
 				recipient := monkey.next(newWl)
+				if tracer != nil {
+					tracer.WorryChange(monkey.operation.describe(), inspected)
+					if desc := relief.describe(); desc != "" {
+						tracer.Relief(desc, newWl)
+					}
+					tracer.Test(monkey.divisor, int(newWl)%monkey.divisor == 0)
+					tracer.Throw(newWl, recipient)
+				}
 				if nextMonkey, ok := monkeysById[recipient]; ok {
 					nextMonkey.items = append(nextMonkey.items, newWl)
 				} else {
@@ -97,119 +227,717 @@ func (p MonkeyInTheMiddle) processRounds(rounds int, rm ReliefMaker, monkeys []*
 				inspections[monkey.id]++
 			}
 		}
+		if tracer != nil {
+			holdings := make([]MonkeyHoldings, len(monkeys))
+			for i, monkey := range monkeys {
+				holdings[i] = MonkeyHoldings{Monkey: monkey.id, Items: append([]WorryLevel{}, monkey.items...)}
+			}
+			tracer.RoundEnd(round, holdings)
+		}
+	}
+	return inspections, nil
+}
+
+func (p MonkeyInTheMiddle) initInspections(monkeys []*Monkey) map[MonkeyId]int {
+	inspections := map[MonkeyId]int{}
+	for _, monkey := range monkeys {
+		inspections[monkey.id] = 0
+	}
+	return inspections
+}
+
+// processRoundsBig is the arbitrary-precision counterpart of processRounds.
+func (p MonkeyInTheMiddle) processRoundsBig(rounds int, rm ReliefMaker, monkeys []*Monkey) (map[MonkeyId]int, error) {
+	monkeysById, err := p.indexMonkeys(monkeys)
+	if err != nil {
+		return nil, err
+	}
+	inspections := p.initInspections(monkeys)
+	relief, err := rm(monkeys)
+	if err != nil {
+		return nil, err
+	}
+	items := map[MonkeyId][]*big.Int{}
+	for _, monkey := range monkeys {
+		for _, wl := range monkey.items {
+			items[monkey.id] = append(items[monkey.id], big.NewInt(int64(wl)))
+		}
+	}
+
+	for round := 0; round < rounds; round++ {
+		for _, monkey := range monkeys {
+			monkeyItems := items[monkey.id]
+			items[monkey.id] = nil
+			divisor := big.NewInt(int64(monkey.divisor))
+			for _, wl := range monkeyItems {
+				inspected, err := monkey.operation.evalBig(wl)
+				if err != nil {
+					return nil, fmt.Errorf("monkey %s inspecting an item with worry level %s: %w", monkey.id, wl, err)
+				}
+				newWl := relief.reduceBig(inspected)
+				recipient := monkey.whenFalse
+				if new(big.Int).Rem(newWl, divisor).Sign() == 0 {
+					recipient = monkey.whenTrue
+				}
+				if _, ok := monkeysById[recipient]; !ok {
+					return nil, fmt.Errorf("invalid recipient id: %s", recipient)
+				}
+				items[recipient] = append(items[recipient], newWl)
+				inspections[monkey.id]++
+			}
+		}
 	}
 	return inspections, nil
 }
 
+// processRoundsPerItem computes the same inspection counts as processRounds
+// by following each item on its own, as an item's trajectory doesn't depend
+// on any other item. Once the state of an item at the start of a round (the
+// monkey holding it and its worry level) repeats, the inspections of the
+// remaining rounds are extrapolated from the cycle, which makes billions of
+// rounds feasible when worry levels are bounded (e.g. modByDivisorsRelief).
+func (p MonkeyInTheMiddle) processRoundsPerItem(rounds int, rm ReliefMaker, monkeys []*Monkey) (map[MonkeyId]int, error) {
+	if _, err := p.indexMonkeys(monkeys); err != nil {
+		return nil, err
+	}
+	positions := map[MonkeyId]int{}
+	for i, monkey := range monkeys {
+		positions[monkey.id] = i
+	}
+	relief, err := rm(monkeys)
+	if err != nil {
+		return nil, err
+	}
+
+	inspections := p.initInspections(monkeys)
+	for i, monkey := range monkeys {
+		for _, wl := range monkey.items {
+			counts, err := p.followItem(rounds, relief, monkeys, positions, itemState{monkey: i, wl: wl})
+			if err != nil {
+				return nil, err
+			}
+			for j, count := range counts {
+				inspections[monkeys[j].id] += count
+			}
+		}
+	}
+	return inspections, nil
+}
+
+// processManyRounds follows the items individually, but reports overflows
+// like processRounds: as items overflow in a different order when followed
+// individually, the rounds are replayed to find the first overflow.
+func (p MonkeyInTheMiddle) processManyRounds(rounds int, rm ReliefMaker, monkeys []*Monkey) (map[MonkeyId]int, error) {
+	counts, err := p.processRoundsPerItem(rounds, rm, monkeys)
+	var overflow *WorryOverflowError
+	if errors.As(err, &overflow) {
+		return p.processRounds(rounds, rm, monkeys, nil)
+	}
+	return counts, err
+}
+
+type itemState struct {
+	monkey int // position of the monkey holding the item
+	wl     WorryLevel
+}
+
+// followItem returns how many times each monkey inspects the item.
+func (p MonkeyInTheMiddle) followItem(rounds int, relief Relief, monkeys []*Monkey, positions map[MonkeyId]int, state itemState) ([]int, error) {
+	counts := make([]int, len(monkeys))
+	seen := map[itemState]int{} // round in which each state was first seen
+	var history [][]int         // monkeys that inspected the item in each round
+
+	for round := 0; round < rounds; round++ {
+		if first, ok := seen[state]; ok {
+			cycle := history[first:round]
+			remaining := rounds - round
+			for _, inspectors := range cycle {
+				for _, m := range inspectors {
+					counts[m] += remaining / len(cycle)
+				}
+			}
+			for _, inspectors := range cycle[:remaining%len(cycle)] {
+				for _, m := range inspectors {
+					counts[m]++
+				}
+			}
+			return counts, nil
+		}
+		seen[state] = round
+
+		var inspectors []int
+		for {
+			monkey := monkeys[state.monkey]
+			inspected, err := monkey.inspect(state.wl)
+			if errors.Is(err, errWorryOverflow) {
+				return nil, &WorryOverflowError{Round: round + 1, Monkey: monkey.id, Worry: state.wl}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("monkey %s inspecting an item with worry level %d: %w", monkey.id, state.wl, err)
+			}
+			newWl := relief.reduce(inspected)
+			recipient, ok := positions[monkey.next(newWl)]
+			if !ok {
+				return nil, fmt.Errorf("invalid recipient id: %s", monkey.next(newWl))
+			}
+			inspectors = append(inspectors, state.monkey)
+			counts[state.monkey]++
+
+			// items thrown to a monkey that already had its turn wait for the next round
+			done := recipient <= state.monkey
+			state = itemState{monkey: recipient, wl: newWl}
+			if done {
+				break
+			}
+		}
+		history = append(history, inspectors)
+	}
+	return counts, nil
+}
+
+func (p MonkeyInTheMiddle) indexMonkeys(monkeys []*Monkey) (map[MonkeyId]*Monkey, error) {
+	monkeysById := map[MonkeyId]*Monkey{}
+	for _, monkey := range monkeys {
+		if _, ok := monkeysById[monkey.id]; ok {
+			return nil, fmt.Errorf("duplicate monkey id: %s", monkey.id)
+		}
+		monkeysById[monkey.id] = monkey
+	}
+	return monkeysById, nil
+}
+
 var (
-	monkeyRgx = regexp.MustCompile(`^Monkey (.+?):$`)
-	itemsRgx  = regexp.MustCompile(`^\s+Starting items: (.*)`)
-	opRgx     = regexp.MustCompile(`^\s+Operation: new = (old|\d+) ([+*]) (old|\d+)$`)
-	testRgx   = regexp.MustCompile(`^\s+Test: divisible by (\d+)$`)
-	trueRgx   = regexp.MustCompile(`^\s+If true: throw to monkey (.+)$`)
-	falseRgx  = regexp.MustCompile(`^\s+If false: throw to monkey (.+)$`)
+	monkeyRgx = regexp.MustCompile(`^\s*Monkey\s+(\S+?)\s*:\s*$`)
+	noteRgx   = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z ]*?)\s*:\s*`)
+	opRgx     = regexp.MustCompile(`^new\s*=\s*`)
+	testRgx   = regexp.MustCompile(`^divisible\s+by\s+(\d+)\s*$`)
+	throwRgx  = regexp.MustCompile(`^throw\s+to\s+monkey\s+(\S+)\s*$`)
 )
 
+// monkeyNotes lists the notes expected after the header of each monkey. The
+// notes must appear in ascending rank, though notes of the same rank can be
+// swapped.
+var monkeyNotes = []struct {
+	label string
+	rank  int
+}{
+	{label: "Starting items", rank: 0},
+	{label: "Operation", rank: 1},
+	{label: "Test", rank: 2},
+	{label: "If true", rank: 3},
+	{label: "If false", rank: 3},
+}
+
 func (p MonkeyInTheMiddle) parseNotes(input *Input) ([]*Monkey, error) {
-	lines := input.Lines()
+	return p.readNotes(input.ParagraphIterator())
+}
+
+func (p MonkeyInTheMiddle) readNotes(notes *Iterator) ([]*Monkey, error) {
 	var result []*Monkey
 
-	for i := 0; i < len(lines); {
-		if lines[i] == "" {
-			i++
-			continue
-		}
-		// id
-		if !monkeyRgx.MatchString(lines[i]) {
-			return nil, fmt.Errorf("invalid line: %s", lines[i])
-		}
-		monkeyLineGroups := monkeyRgx.FindAllStringSubmatch(lines[i], -1)
-		id := MonkeyId(monkeyLineGroups[0][1])
-		// items
-		if !itemsRgx.MatchString(lines[i+1]) {
-			return nil, fmt.Errorf("invalid line: %s", lines[i+1])
-		}
-		itemsLineGroups := itemsRgx.FindAllStringSubmatch(lines[i+1], -1)
-		var items []WorryLevel
-		for _, sitem := range strings.Split(itemsLineGroups[0][1], ", ") {
-			item, err := strconv.Atoi(sitem)
-			if err != nil {
-				return nil, fmt.Errorf("invalid line: %s", lines[i])
-			}
-			items = append(items, WorryLevel(item))
-		}
-		// operation
-		if !opRgx.MatchString(lines[i+2]) {
-			return nil, fmt.Errorf("invalid line: %s", lines[i+2])
+	for notes.Next() {
+		monkey, err := p.parseMonkey(notes.Record(), notes.Line())
+		if err != nil {
+			return nil, err
 		}
-		opLineGroups := opRgx.FindAllStringSubmatch(lines[i+2], -1)
-		leftOperand := opLineGroups[0][1]
-		operator := opLineGroups[0][2]
-		rightOperand := opLineGroups[0][3]
-		convOperand := func(operand string, wl WorryLevel) int {
-			switch operand {
-			case "old":
-				return int(wl)
-			default:
-				n, _ := strconv.Atoi(operand)
-				return n
+		result = append(result, monkey)
+	}
+	return result, notes.Err()
+}
+
+// parseMonkey parses the notes of a single monkey starting on the given
+// (1-based) line.
+func (p MonkeyInTheMiddle) parseMonkey(lines []string, firstLine int) (*Monkey, error) {
+	// invalid reports an error on the i-th line of the notes, at the given
+	// byte offset (or on the whole line if offset is negative).
+	invalid := func(i, offset int, expected string) error {
+		err := &ParseError{Day: p.Details().Day, Line: firstLine + i, Expected: expected}
+		if i < len(lines) {
+			err.Text = lines[i]
+			if offset >= 0 {
+				err.Column = column(lines[i], offset)
 			}
 		}
-		operation := func(wl WorryLevel) WorryLevel {
-			lhs := convOperand(leftOperand, wl)
-			rhs := convOperand(rightOperand, wl)
-			switch operator {
-			case "+":
-				return WorryLevel(lhs + rhs)
-			case "*":
-				return WorryLevel(lhs * rhs)
-			default:
-				panic(fmt.Sprintf("unexpected operator: %s", operator))
+		return err
+	}
+
+	// id
+	groups := monkeyRgx.FindStringSubmatch(lines[0])
+	if groups == nil {
+		return nil, invalid(0, -1, "a monkey header such as 'Monkey 0:'")
+	}
+	id := MonkeyId(groups[1])
+
+	// locate notes, making sure they are all present and in the right order
+	noteLines := make([]int, len(monkeyNotes))    // index of the line of each note
+	valueOffsets := make([]int, len(monkeyNotes)) // byte offset of the value of each note
+	last := -1
+
+	for i := 1; i < len(lines); i++ {
+		loc := noteRgx.FindStringSubmatchIndex(lines[i])
+		note := -1
+		if loc != nil {
+			label := strings.Join(strings.Fields(lines[i][loc[2]:loc[3]]), " ")
+			for n := range monkeyNotes {
+				if monkeyNotes[n].label == label {
+					note = n
+				}
 			}
 		}
-		// test
-		if !testRgx.MatchString(lines[i+3]) {
-			return nil, fmt.Errorf("invalid line: %s", lines[i+3])
+		if note < 0 {
+			return nil, invalid(i, -1, "a note among 'Starting items', 'Operation', 'Test', 'If true' and 'If false'")
 		}
-		if !trueRgx.MatchString(lines[i+4]) {
-			return nil, fmt.Errorf("invalid line: %s", lines[i+4])
+		if noteLines[note] > 0 {
+			return nil, invalid(i, -1, fmt.Sprintf("a single '%s' note", monkeyNotes[note].label))
 		}
-		if !falseRgx.MatchString(lines[i+5]) {
-			return nil, fmt.Errorf("invalid line: %s", lines[i+5])
+		if last >= 0 && monkeyNotes[note].rank < monkeyNotes[last].rank {
+			return nil, invalid(i, -1, fmt.Sprintf("'%s' note before '%s'", monkeyNotes[note].label, monkeyNotes[last].label))
 		}
-		testLineGroups := testRgx.FindAllStringSubmatch(lines[i+3], -1)
-		trueLineGroups := trueRgx.FindAllStringSubmatch(lines[i+4], -1)
-		falseLineGroups := falseRgx.FindAllStringSubmatch(lines[i+5], -1)
-		divisor, _ := strconv.Atoi(testLineGroups[0][1])
-		whenTrue := MonkeyId(trueLineGroups[0][1])
-		whenFalse := MonkeyId(falseLineGroups[0][1])
-		decideNext := func(wl WorryLevel) MonkeyId {
-			if int(wl)%divisor == 0 {
-				return whenTrue
+		noteLines[note] = i
+		valueOffsets[note] = loc[1]
+		last = note
+	}
+
+	for n, i := range noteLines {
+		if i == 0 {
+			return nil, invalid(len(lines), -1, fmt.Sprintf("a '%s' note", monkeyNotes[n].label))
+		}
+	}
+	value := func(n int) (int, int, string) {
+		i, offset := noteLines[n], valueOffsets[n]
+		return i, offset, lines[i][offset:]
+	}
+
+	// items
+	i, offset, itemsValue := value(0)
+	var items []WorryLevel
+	if strings.TrimSpace(itemsValue) != "" {
+		for _, sitem := range strings.Split(itemsValue, ",") {
+			trimmed := strings.TrimSpace(sitem)
+			itemOffset := offset + strings.Index(sitem, trimmed)
+			item, err := strconv.Atoi(trimmed)
+			if err != nil || item < 0 {
+				return nil, invalid(i, itemOffset, "a worry level")
 			}
-			return whenFalse
+			items = append(items, WorryLevel(item))
+			offset += len(sitem) + len(",")
 		}
+	}
+
+	// operation
+	i, offset, opValue := value(1)
+	opLoc := opRgx.FindStringIndex(opValue)
+	if opLoc == nil {
+		return nil, invalid(i, offset, "an operation such as 'new = old * 19'")
+	}
+	operation, pos, expected := parseOpExpr(opValue[opLoc[1]:])
+	if operation == nil {
+		return nil, invalid(i, offset+opLoc[1]+pos, expected)
+	}
+
+	// test
+	i, offset, testValue := value(2)
+	testGroups := testRgx.FindStringSubmatchIndex(testValue)
+	if testGroups == nil {
+		return nil, invalid(i, offset, "a test such as 'divisible by 23'")
+	}
+	divisor, err := strconv.Atoi(testValue[testGroups[2]:testGroups[3]])
+	if err != nil || divisor == 0 {
+		return nil, invalid(i, offset+testGroups[2], "a positive divisor")
+	}
+	recipient := func(n int) (MonkeyId, error) {
+		i, offset, throwValue := value(n)
+		groups := throwRgx.FindStringSubmatch(throwValue)
+		if groups == nil {
+			return "", invalid(i, offset, "an action such as 'throw to monkey 2'")
+		}
+		return MonkeyId(groups[1]), nil
+	}
+	whenTrue, err := recipient(3)
+	if err != nil {
+		return nil, err
+	}
+	whenFalse, err := recipient(4)
+	if err != nil {
+		return nil, err
+	}
+	decideNext := func(wl WorryLevel) MonkeyId {
+		if int(wl)%divisor == 0 {
+			return whenTrue
+		}
+		return whenFalse
+	}
+
+	return &Monkey{
+		id:        id,
+		items:     items,
+		divisor:   divisor,
+		operation: operation,
+		inspect:   operation.eval,
+		next:      decideNext,
+		whenTrue:  whenTrue,
+		whenFalse: whenFalse,
+	}, nil
+}
+
+// MonkeyTracer receives the events of a simulation as they happen. Round
+// numbers are 1-based.
+type MonkeyTracer interface {
+	Turn(round int, monkey MonkeyId)
+	Inspect(wl WorryLevel)
+	WorryChange(change string, wl WorryLevel)
+	Relief(relief string, wl WorryLevel)
+	Test(divisor int, divisible bool)
+	Throw(wl WorryLevel, recipient MonkeyId)
+	RoundEnd(round int, holdings []MonkeyHoldings)
+}
+
+type MonkeyHoldings struct {
+	Monkey MonkeyId
+	Items  []WorryLevel
+}
+
+// MonkeyNarrator is a MonkeyTracer that writes the simulation in the same
+// format as the puzzle's description. Write errors are ignored.
+type MonkeyNarrator struct {
+	w io.Writer
+}
 
-		result = append(result, &Monkey{
-			id:      id,
-			items:   items,
-			divisor: divisor,
-			inspect: operation,
-			next:    decideNext,
-		})
-		i += 6
+func NewMonkeyNarrator(w io.Writer) *MonkeyNarrator {
+	return &MonkeyNarrator{w: w}
+}
+
+func (n *MonkeyNarrator) Turn(round int, monkey MonkeyId) {
+	fmt.Fprintf(n.w, "Monkey %s:\n", monkey)
+}
+
+func (n *MonkeyNarrator) Inspect(wl WorryLevel) {
+	fmt.Fprintf(n.w, "  Monkey inspects an item with a worry level of %d.\n", wl)
+}
+
+func (n *MonkeyNarrator) WorryChange(change string, wl WorryLevel) {
+	fmt.Fprintf(n.w, "    %s to %d.\n", change, wl)
+}
+
+func (n *MonkeyNarrator) Relief(relief string, wl WorryLevel) {
+	fmt.Fprintf(n.w, "    %s to %d.\n", relief, wl)
+}
+
+func (n *MonkeyNarrator) Test(divisor int, divisible bool) {
+	if divisible {
+		fmt.Fprintf(n.w, "    Current worry level is divisible by %d.\n", divisor)
+	} else {
+		fmt.Fprintf(n.w, "    Current worry level is not divisible by %d.\n", divisor)
 	}
-	return result, nil
 }
 
-func (p MonkeyInTheMiddle) divBy3Relief(monkeys []*Monkey) Relief {
-	return func(wl WorryLevel) WorryLevel { return wl / 3 }
+func (n *MonkeyNarrator) Throw(wl WorryLevel, recipient MonkeyId) {
+	fmt.Fprintf(n.w, "    Item with worry level %d is thrown to monkey %s.\n", wl, recipient)
+}
+
+func (n *MonkeyNarrator) RoundEnd(round int, holdings []MonkeyHoldings) {
+	fmt.Fprintf(n.w, "\nAfter round %d, the monkeys are holding items with these worry levels:\n", round)
+	for _, h := range holdings {
+		items := make([]string, len(h.Items))
+		for i, wl := range h.Items {
+			items[i] = strconv.Itoa(int(wl))
+		}
+		fmt.Fprintf(n.w, "Monkey %s: %s\n", h.Monkey, strings.Join(items, ", "))
+	}
+	fmt.Fprintln(n.w)
 }
 
-func (p MonkeyInTheMiddle) modByDivisorsRelief(monkeys []*Monkey) Relief {
+type divRelief int
+
+func (r divRelief) reduce(wl WorryLevel) WorryLevel { return wl / WorryLevel(r) }
+
+func (r divRelief) reduceBig(wl *big.Int) *big.Int { return wl.Quo(wl, big.NewInt(int64(r))) }
+
+func (r divRelief) describe() string {
+	return fmt.Sprintf("Monkey gets bored with item. Worry level is divided by %d", r)
+}
+
+type modRelief int
+
+func (r modRelief) reduce(wl WorryLevel) WorryLevel { return wl % WorryLevel(r) }
+
+func (r modRelief) reduceBig(wl *big.Int) *big.Int { return wl.Rem(wl, big.NewInt(int64(r))) }
+
+func (r modRelief) describe() string {
+	return fmt.Sprintf("Worry level is kept manageable by taking its remainder of the division by %d", r)
+}
+
+type noRelief struct{}
+
+func (r noRelief) reduce(wl WorryLevel) WorryLevel { return wl }
+
+func (r noRelief) reduceBig(wl *big.Int) *big.Int { return wl }
+
+func (r noRelief) describe() string { return "" }
+
+func (p MonkeyInTheMiddle) noRelief(monkeys []*Monkey) (Relief, error) {
+	return noRelief{}, nil
+}
+
+func (p MonkeyInTheMiddle) divBy3Relief(monkeys []*Monkey) (Relief, error) {
+	return divRelief(3), nil
+}
+
+// modByDivisorsRelief keeps worry levels manageable by reducing them modulo
+// the product of all divisors, which preserves the outcome of every test as
+// long as the operations only add, subtract and multiply.
+func (p MonkeyInTheMiddle) modByDivisorsRelief(monkeys []*Monkey) (Relief, error) {
 	divisor := 1
 	for _, m := range monkeys {
+		if !m.operation.modular() {
+			return nil, fmt.Errorf("operation of monkey %s is incompatible with modular reduction: new = %s", m.id, m.operation)
+		}
+		if divisor > math.MaxInt/m.divisor {
+			return nil, errors.New("product of divisors is too large for modular reduction")
+		}
 		divisor *= m.divisor
 	}
-	return func(wl WorryLevel) WorryLevel { return WorryLevel(int(wl) % divisor) }
+	return modRelief(divisor), nil
+}
+
+// opExpr is a node of the arithmetic expression that computes the new worry
+// level of an item from the old one.
+type opExpr interface {
+	// eval returns errWorryOverflow if the result doesn't fit in a WorryLevel.
+	eval(old WorryLevel) (WorryLevel, error)
+	evalBig(old *big.Int) (*big.Int, error)
+	// modular reports whether the result of the expression modulo any number
+	// is preserved when "old" is replaced by its remainder modulo that number.
+	modular() bool
+	// describe narrates how the expression changes the worry level.
+	describe() string
+	String() string
+}
+
+type oldRef struct{}
+
+func (o oldRef) eval(old WorryLevel) (WorryLevel, error) { return old, nil }
+func (o oldRef) evalBig(old *big.Int) (*big.Int, error)  { return old, nil }
+func (o oldRef) modular() bool                           { return true }
+func (o oldRef) describe() string                        { return "Worry level stays unchanged" }
+func (o oldRef) String() string                          { return "old" }
+
+type constExpr int
+
+func (c constExpr) eval(old WorryLevel) (WorryLevel, error) { return WorryLevel(c), nil }
+func (c constExpr) evalBig(old *big.Int) (*big.Int, error)  { return big.NewInt(int64(c)), nil }
+func (c constExpr) modular() bool                           { return true }
+func (c constExpr) describe() string                        { return "Worry level is set to " + c.String() }
+func (c constExpr) String() string                          { return strconv.Itoa(int(c)) }
+
+type binaryExpr struct {
+	operator byte
+	lhs, rhs opExpr
+}
+
+func (b binaryExpr) eval(old WorryLevel) (WorryLevel, error) {
+	lhs, err := b.lhs.eval(old)
+	if err != nil {
+		return 0, err
+	}
+	rhs, err := b.rhs.eval(old)
+	if err != nil {
+		return 0, err
+	}
+	switch b.operator {
+	case '+':
+		if (rhs > 0 && lhs > math.MaxInt-rhs) || (rhs < 0 && lhs < math.MinInt-rhs) {
+			return 0, errWorryOverflow
+		}
+		return lhs + rhs, nil
+	case '-':
+		if (rhs < 0 && lhs > math.MaxInt+rhs) || (rhs > 0 && lhs < math.MinInt+rhs) {
+			return 0, errWorryOverflow
+		}
+		return lhs - rhs, nil
+	case '*':
+		result := lhs * rhs
+		if lhs != 0 && (result/lhs != rhs || (lhs == -1 && rhs == math.MinInt)) {
+			return 0, errWorryOverflow
+		}
+		return result, nil
+	case '/', '%':
+		if rhs == -1 && lhs == math.MinInt {
+			return 0, errWorryOverflow
+		}
+		if rhs == 0 {
+			return 0, fmt.Errorf("division by zero in %s", b)
+		}
+		if b.operator == '/' {
+			return lhs / rhs, nil
+		}
+		return lhs % rhs, nil
+	default:
+		return 0, fmt.Errorf("unexpected operator: %c", b.operator)
+	}
+}
+
+func (b binaryExpr) evalBig(old *big.Int) (*big.Int, error) {
+	lhs, err := b.lhs.evalBig(old)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := b.rhs.evalBig(old)
+	if err != nil {
+		return nil, err
+	}
+	result := new(big.Int)
+	switch b.operator {
+	case '+':
+		return result.Add(lhs, rhs), nil
+	case '-':
+		return result.Sub(lhs, rhs), nil
+	case '*':
+		return result.Mul(lhs, rhs), nil
+	case '/', '%':
+		if rhs.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero in %s", b)
+		}
+		if b.operator == '/' {
+			return result.Quo(lhs, rhs), nil
+		}
+		return result.Rem(lhs, rhs), nil
+	default:
+		return nil, fmt.Errorf("unexpected operator: %c", b.operator)
+	}
+}
+
+func (b binaryExpr) describe() string {
+	if _, ok := b.lhs.(oldRef); ok {
+		operand := b.rhs.String()
+		if _, ok := b.rhs.(oldRef); ok {
+			operand = "itself"
+		}
+		if _, ok := b.rhs.(binaryExpr); !ok {
+			switch b.operator {
+			case '+':
+				return "Worry level increases by " + operand
+			case '-':
+				return "Worry level decreases by " + operand
+			case '*':
+				return "Worry level is multiplied by " + operand
+			case '/':
+				return "Worry level is divided by " + operand
+			}
+		}
+	}
+	return "Worry level is set to " + b.String()
+}
+
+func (b binaryExpr) modular() bool {
+	return b.operator != '/' && b.operator != '%' && b.lhs.modular() && b.rhs.modular()
+}
+
+func (b binaryExpr) String() string {
+	return fmt.Sprintf("(%s %c %s)", b.lhs, b.operator, b.rhs)
+}
+
+// parseOpExpr parses expressions made of integers, "old", parentheses and the
+// operators +, -, *, / and % (with the usual precedence), compiling them into
+// a tree that can be evaluated for each item. On failure, it returns a nil
+// expression along with the byte offset of the error and a description of
+// what was expected there.
+func parseOpExpr(text string) (opExpr, int, string) {
+	ep := opExprParser{text: text}
+	result := ep.parseSum()
+	if ep.expected == "" {
+		if ep.skipSpaces(); ep.pos < len(text) {
+			ep.fail("an operator")
+		}
+	}
+	if ep.expected != "" {
+		return nil, ep.pos, ep.expected
+	}
+	return result, 0, ""
+}
+
+type opExprParser struct {
+	text     string
+	pos      int
+	expected string // set when parsing fails
+}
+
+func (ep *opExprParser) fail(expected string) opExpr {
+	if ep.expected == "" {
+		ep.expected = expected
+	}
+	return nil
+}
+
+func (ep *opExprParser) skipSpaces() {
+	for ep.pos < len(ep.text) && (ep.text[ep.pos] == ' ' || ep.text[ep.pos] == '\t') {
+		ep.pos++
+	}
+}
+
+// next returns the next non-space character without consuming it, or 0 at
+// the end of the text.
+func (ep *opExprParser) next() byte {
+	ep.skipSpaces()
+	if ep.pos == len(ep.text) {
+		return 0
+	}
+	return ep.text[ep.pos]
+}
+
+// parseSum parses: product (('+' | '-') product)*
+func (ep *opExprParser) parseSum() opExpr {
+	return ep.parseBinary("+-", ep.parseProduct)
+}
+
+// parseProduct parses: operand (('*' | '/' | '%') operand)*
+func (ep *opExprParser) parseProduct() opExpr {
+	return ep.parseBinary("*/%", ep.parseOperand)
+}
+
+func (ep *opExprParser) parseBinary(operators string, parseOperand func() opExpr) opExpr {
+	result := parseOperand()
+	for ep.expected == "" {
+		operator := ep.next()
+		if operator == 0 || !strings.ContainsRune(operators, rune(operator)) {
+			break
+		}
+		ep.pos++
+		rhs := parseOperand()
+		result = binaryExpr{operator: operator, lhs: result, rhs: rhs}
+	}
+	return result
+}
+
+// parseOperand parses: number | 'old' | '(' sum ')'
+func (ep *opExprParser) parseOperand() opExpr {
+	switch c := ep.next(); {
+	case c == '(':
+		ep.pos++
+		result := ep.parseSum()
+		if ep.expected != "" {
+			return nil
+		}
+		if ep.next() != ')' {
+			return ep.fail("')'")
+		}
+		ep.pos++
+		return result
+	case c >= '0' && c <= '9':
+		start := ep.pos
+		for ep.pos < len(ep.text) && ep.text[ep.pos] >= '0' && ep.text[ep.pos] <= '9' {
+			ep.pos++
+		}
+		n, err := strconv.Atoi(ep.text[start:ep.pos])
+		if err != nil {
+			ep.pos = start
+			return ep.fail("a number that fits in an int")
+		}
+		return constExpr(n)
+	case strings.HasPrefix(ep.text[ep.pos:], "old"):
+		ep.pos += len("old")
+		return oldRef{}
+	default:
+		return ep.fail("a number, 'old' or '('")
+	}
 }
@@ -2,7 +2,7 @@
 package adventofcode
 
 import (
-	"errors"
+	"fmt"
 	"math"
 	"strconv"
 )
@@ -131,13 +131,9 @@ func (h *heightmap) neighbors(p pos) []pos {
 func (p HillClimbingAlgorithm) parseHeightmap(input *Input) (*heightmap, error) {
 	lines := input.Lines()
 	height := len(lines)
-	if height == 0 {
-		return nil, errors.New("empty input")
-	}
-
 	width := len(lines[0])
 	if width == 0 {
-		return nil, errors.New("empty input")
+		return nil, &ParseError{Day: p.Details().Day, Line: 1, Expected: "a row of squares"}
 	}
 
 	hm := &heightmap{
@@ -148,7 +144,17 @@ func (p HillClimbingAlgorithm) parseHeightmap(input *Input) (*heightmap, error)
 
 	for r, line := range lines {
 		if len(line) != width {
-			return nil, errors.New("all lines must have the same length")
+			col := len(line)
+			if width < col {
+				col = width
+			}
+			return nil, &ParseError{
+				Day:      p.Details().Day,
+				Line:     r + 1,
+				Column:   col + 1,
+				Text:     line,
+				Expected: fmt.Sprintf("a row of %d squares", width),
+			}
 		}
 
 		hm.grid[r] = make([]rune, width)
@@ -166,6 +172,16 @@ func (p HillClimbingAlgorithm) parseHeightmap(input *Input) (*heightmap, error)
 				continue
 			}
 
+			if square < 'a' || square > 'z' {
+				return nil, &ParseError{
+					Day:      p.Details().Day,
+					Line:     r + 1,
+					Column:   column(line, c),
+					Text:     line,
+					Expected: "a square elevation (a-z), S or E",
+				}
+			}
+
 			hm.grid[r][c] = square
 		}
 	}
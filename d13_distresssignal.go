@@ -3,7 +3,7 @@ package adventofcode
 
 import (
 	"fmt"
-	"sort"
+	"io"
 	"strconv"
 	"strings"
 )
@@ -20,12 +20,35 @@ func (p DistressSignal) Solve(input *Input) (Result, error) {
 		return Result{}, err
 	}
 
+	key, err := p.decoderKey(pairs, "[[2]]", "[[6]]")
+	if err != nil {
+		return Result{}, err
+	}
+
 	return Result{
 		Part1: strconv.Itoa(p.sumIndexOfPairsInTheRightOrder(pairs)),
-		Part2: strconv.Itoa(p.decoderKey(pairs)),
+		Part2: strconv.Itoa(key),
 	}, nil
 }
 
+// Explain writes a walkthrough of the comparison of every pair of packets,
+// like the one in the puzzle description.
+func (p DistressSignal) Explain(input *Input, w io.Writer) error {
+	pairs, err := p.parse(input)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "== Pair %d ==\n%v\n", i+1, pair.left.explainCompare(pair.right))
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
 func (p DistressSignal) sumIndexOfPairsInTheRightOrder(pairs []packetPair) int {
 	var result int
 	for i, pair := range pairs {
@@ -36,41 +59,82 @@ func (p DistressSignal) sumIndexOfPairsInTheRightOrder(pairs []packetPair) int {
 	return result
 }
 
-func (p DistressSignal) decoderKey(pairs []packetPair) int {
-	var packets []packet
-	for _, pair := range pairs {
-		packets = append(packets, pair.left, pair.right)
+// DecoderKey returns the product of the (1-based) indexes the given divider
+// packets would have if they were added to the packets of the input and all
+// of them were sorted.
+func (p DistressSignal) DecoderKey(input *Input, dividers ...string) (int, error) {
+	pairs, err := p.parse(input)
+	if err != nil {
+		return 0, err
 	}
-	sort.Slice(packets, func(i, j int) bool { return packets[i].compare(packets[j]) < 0 })
-
-	i, j := 1, len(packets)
-	div1 := packet{listValue{intValue(2).asList()}}
-	div2 := packet{listValue{intValue(6).asList()}}
+	return p.decoderKey(pairs, dividers...)
+}
 
-	for ; i < j && div1.compare(packets[i-1]) > 0; i++ {
-	}
-	for ; j > i && div2.compare(packets[j-1]) < 0; j-- {
+// decoderKey locates the dividers by counting the packets (and other
+// dividers) that come before each of them, which takes linear time per
+// divider instead of sorting all packets. Packets equal to a divider come
+// after it, as do equal dividers given later.
+func (p DistressSignal) decoderKey(pairs []packetPair, dividers ...string) (int, error) {
+	divs := make([]packet, len(dividers))
+	for i, d := range dividers {
+		div, err := p.parsePacketLine(d)
+		if err != nil {
+			return 0, fmt.Errorf("divider packet %q: %w", d, err)
+		}
+		divs[i] = div
 	}
 
-	return i * (j + 2)
+	key := 1
+	for i, div := range divs {
+		index := 1
+		for _, pair := range pairs {
+			if pair.left.compare(div) < 0 {
+				index++
+			}
+			if pair.right.compare(div) < 0 {
+				index++
+			}
+		}
+		for j, other := range divs {
+			if order := other.compare(div); order < 0 || (order == 0 && j < i) {
+				index++
+			}
+		}
+		key *= index
+	}
+	return key, nil
 }
 
 type packetData interface {
 	asList() listValue
+	String() string
 }
 
 type listValue []packetData
 
 func (l listValue) asList() listValue { return l }
 
+// String returns the canonical form of the list, without whitespace.
+func (l listValue) String() string {
+	items := make([]string, len(l))
+	for i, item := range l {
+		items[i] = item.String()
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
 type intValue int
 
 func (i intValue) asList() listValue { return listValue{i} }
 
+func (i intValue) String() string { return strconv.Itoa(int(i)) }
+
 type packet struct {
 	data listValue
 }
 
+func (p packet) String() string { return p.data.String() }
+
 func (p packet) compare(that packet) int {
 	var recurse func(left, right listValue) int
 	recurse = func(left, right listValue) int {
@@ -97,8 +161,10 @@ func (p packet) compare(that packet) int {
 			if liInt == riInt {
 				continue
 			}
-
-			return int(liInt - riInt)
+			if liInt < riInt {
+				return -1
+			}
+			return 1
 		}
 
 		// did left run out of items?
@@ -108,6 +174,102 @@ func (p packet) compare(that packet) int {
 	return recurse(p.data, that.data)
 }
 
+// packetList sorts packets in the right order.
+type packetList []packet
+
+func (l packetList) Len() int           { return len(l) }
+func (l packetList) Less(i, j int) bool { return l[i].compare(l[j]) < 0 }
+func (l packetList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// comparison explains how the order of two packets was decided.
+type comparison struct {
+	order int
+	// path holds the indexes of the items, from the outermost list in,
+	// whose comparison decided the order. When a side ran out of items, it
+	// leads to the lists being compared instead.
+	path []int
+	// left and right are the values at path, or nil for equal packets.
+	left, right packetData
+	// promoted tells whether an integer was converted to a list on the way
+	// to the values that decided the order.
+	promoted bool
+	// walkthrough lists every step of the comparison, like the puzzle does.
+	walkthrough []string
+}
+
+func (c *comparison) explain(depth int, format string, args ...any) {
+	c.walkthrough = append(c.walkthrough, strings.Repeat("  ", depth)+"- "+fmt.Sprintf(format, args...))
+}
+
+func (c *comparison) decide(order int, path []int, left, right packetData) int {
+	c.order, c.path, c.left, c.right = order, path, left, right
+	return order
+}
+
+func (c comparison) String() string {
+	return strings.Join(c.walkthrough, "\n")
+}
+
+// explainCompare compares the packets like compare does, keeping track of
+// how the order was decided.
+func (p packet) explainCompare(that packet) comparison {
+	var c comparison
+	var recurse func(left, right packetData, path []int, depth int) int
+	recurse = func(left, right packetData, path []int, depth int) int {
+		c.explain(depth, "Compare %v vs %v", left, right)
+		liInt, liIntOk := left.(intValue)
+		riInt, riIntOk := right.(intValue)
+
+		switch {
+		case liIntOk && riIntOk:
+			if liInt < riInt {
+				c.explain(depth+1, "Left side is smaller, so inputs are in the right order")
+				return c.decide(-1, path, left, right)
+			}
+			if liInt > riInt {
+				c.explain(depth+1, "Right side is smaller, so inputs are not in the right order")
+				return c.decide(1, path, left, right)
+			}
+			return 0
+		case liIntOk || riIntOk:
+			side, promoted := "left", left.asList()
+			if riIntOk {
+				side, promoted = "right", right.asList()
+			}
+			c.explain(depth+1, "Mixed types; convert %s to %v and retry comparison", side, promoted)
+			var order int
+			if liIntOk {
+				order = recurse(promoted, right, path, depth+1)
+			} else {
+				order = recurse(left, promoted, path, depth+1)
+			}
+			if order != 0 {
+				c.promoted = true
+			}
+			return order
+		}
+
+		ll, rl := left.asList(), right.asList()
+		for i := range ll {
+			if i == len(rl) {
+				c.explain(depth+1, "Right side ran out of items, so inputs are not in the right order")
+				return c.decide(1, path, left, right)
+			}
+			if order := recurse(ll[i], rl[i], append(path[:len(path):len(path)], i), depth+1); order != 0 {
+				return order
+			}
+		}
+		if len(ll) < len(rl) {
+			c.explain(depth+1, "Left side ran out of items, so inputs are in the right order")
+			return c.decide(-1, path, left, right)
+		}
+		return 0
+	}
+
+	recurse(p.data, that.data, nil, 0)
+	return c
+}
+
 type packetPair struct {
 	left, right packet
 }
@@ -122,19 +284,27 @@ func (p DistressSignal) parse(input *Input) ([]packetPair, error) {
 	lines := input.Lines()
 
 	for idx, line := range lines {
-		line = strings.TrimSpace(line)
+		trimmed := strings.TrimSpace(line)
 
-		if line != "" {
-			packet, err := p.parsePacketLine(line)
+		if trimmed != "" {
+			packet, err := p.parsePacketLine(trimmed)
 			if err != nil {
+				// the error is reported against the line as found in the input
+				indent := strings.Index(line, trimmed)
+				err.Line, err.Column, err.Text = idx+1, column(line, indent)+err.Column-1, line
 				return nil, err
 			}
 			packets = append(packets, packet)
 		}
 
-		if line == "" || idx == len(lines)-1 {
+		if trimmed == "" || idx == len(lines)-1 {
 			if len(packets) != 2 {
-				return nil, fmt.Errorf("invalid input: a pair of packets is expected before line %d", idx+1)
+				return nil, &ParseError{
+					Day:      p.Details().Day,
+					Line:     idx + 1,
+					Text:     line,
+					Expected: fmt.Sprintf("a pair of packets, got %d", len(packets)),
+				}
 			}
 
 			pair := packetPair{left: packets[0], right: packets[1]}
@@ -146,72 +316,141 @@ func (p DistressSignal) parse(input *Input) ([]packetPair, error) {
 	return result, nil
 }
 
-func (p DistressSignal) parsePacketLine(line string) (packet, error) {
-	data, end, err := p.parsePacketData(line, 0)
+// parsePacketLine returns a ParseError without the line set.
+func (p DistressSignal) parsePacketLine(line string) (packet, *ParseError) {
+	tokens, err := p.tokenizePacket(line)
 	if err != nil {
 		return packet{}, err
 	}
-
-	if end < len(line)-1 {
-		return packet{}, fmt.Errorf("invalid packet data: %s", line)
+	parser := packetParser{p: p, line: line, tokens: tokens}
+	data, err := parser.list()
+	if err != nil {
+		return packet{}, err
+	}
+	if tok := parser.next(); tok.kind != endOfPacket {
+		return packet{}, p.invalidPacket(line, tok.offset, "end of packet")
 	}
-
 	return packet{data}, nil
 }
 
-func (p DistressSignal) parsePacketData(line string, start int) (listValue, int, error) {
-	if line[start] != '[' {
-		return listValue{}, 0, fmt.Errorf("invalid packet data: %s", line)
+func (p DistressSignal) invalidPacket(line string, offset int, expected string) *ParseError {
+	return &ParseError{
+		Day:      p.Details().Day,
+		Column:   column(line, offset),
+		Text:     line,
+		Expected: expected,
 	}
+}
 
-	var (
-		result     listValue
-		curInt     string
-		closeFound bool
-	)
-	i := start + 1
-
-	for ; i < len(line); i++ {
-		curChar := line[i]
+// Kinds of packet tokens other than '[', ']' and ','.
+const (
+	endOfPacket byte = 0
+	integer     byte = '0'
+)
 
-		if curChar >= '0' && curChar <= '9' {
-			curInt += string(curChar)
-			continue
-		}
+type packetToken struct {
+	kind   byte
+	value  int
+	offset int // in bytes
+}
 
-		if curChar == ',' {
-			if curInt != "" {
-				value, _ := strconv.Atoi(curInt)
-				result = append(result, intValue(value))
-				curInt = ""
+// tokenizePacket splits a packet into brackets, commas and (possibly
+// negative) integers, skipping whitespace. The tokens end with an
+// endOfPacket one.
+func (p DistressSignal) tokenizePacket(line string) ([]packetToken, *ParseError) {
+	var tokens []packetToken
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '[' || c == ']' || c == ',':
+			tokens = append(tokens, packetToken{kind: c, offset: i})
+			i++
+		case c == '-' || isDigit(c):
+			end := i + 1
+			for end < len(line) && isDigit(line[end]) {
+				end++
 			}
-			continue
-		}
-
-		if curChar == '[' {
-			data, end, err := p.parsePacketData(line, i)
+			if c == '-' && end == i+1 {
+				return nil, p.invalidPacket(line, end, "a digit after '-'")
+			}
+			value, err := strconv.Atoi(line[i:end])
 			if err != nil {
-				return listValue{}, 0, err
+				return nil, p.invalidPacket(line, i, "an integer within range")
 			}
-
-			result = append(result, data)
+			tokens = append(tokens, packetToken{kind: integer, value: value, offset: i})
 			i = end
-			continue
+		default:
+			return nil, p.invalidPacket(line, i, "a digit, ',', '[' or ']'")
 		}
+	}
+	return append(tokens, packetToken{kind: endOfPacket, offset: len(line)}), nil
+}
 
-		if curChar == ']' {
-			if curInt != "" {
-				value, _ := strconv.Atoi(curInt)
-				result = append(result, intValue(value))
-			}
-			closeFound = true
-			break
-		}
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// packetParser is a recursive descent parser of the grammar:
+//
+//	list  = "[" [ value { "," value } ] "]"
+//	value = integer | list
+type packetParser struct {
+	p      DistressSignal
+	line   string
+	tokens []packetToken
+	pos    int
+}
+
+func (pp *packetParser) peek() packetToken {
+	return pp.tokens[pp.pos]
+}
+
+func (pp *packetParser) next() packetToken {
+	tok := pp.tokens[pp.pos]
+	if tok.kind != endOfPacket {
+		pp.pos++
 	}
+	return tok
+}
 
-	if !closeFound {
-		return listValue{}, 0, fmt.Errorf("invalid packet data: %s", line)
+func (pp *packetParser) list() (listValue, *ParseError) {
+	if tok := pp.next(); tok.kind != '[' {
+		return nil, pp.p.invalidPacket(pp.line, tok.offset, "'['")
+	}
+	result := listValue{}
+	if pp.peek().kind == ']' {
+		pp.next()
+		return result, nil
 	}
+	for {
+		value, err := pp.value()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+
+		switch tok := pp.next(); tok.kind {
+		case ',':
+		case ']':
+			return result, nil
+		case endOfPacket:
+			return nil, pp.p.invalidPacket(pp.line, tok.offset, "']'")
+		default:
+			return nil, pp.p.invalidPacket(pp.line, tok.offset, "',' or ']'")
+		}
+	}
+}
 
-	return result, i, nil
+func (pp *packetParser) value() (packetData, *ParseError) {
+	switch tok := pp.peek(); tok.kind {
+	case '[':
+		return pp.list()
+	case integer:
+		pp.next()
+		return intValue(tok.value), nil
+	default:
+		return nil, pp.p.invalidPacket(pp.line, tok.offset, "an integer or '['")
+	}
 }
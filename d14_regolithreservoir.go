@@ -2,7 +2,13 @@
 package adventofcode
 
 import (
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -21,28 +27,301 @@ func (p RegolithReservoir) Solve(input *Input) (Result, error) {
 	}
 
 	source := point{x: 500, y: 0}
+	part1, err := p.countPouredUnitsOfSand(rockPaths, source, -1, pathEngine)
+	if err != nil {
+		return Result{}, err
+	}
+	part2, err := p.countPouredUnitsOfSand(rockPaths, source, 1, fillEngine)
+	if err != nil {
+		return Result{}, err
+	}
 	return Result{
-		Part1: strconv.Itoa(p.countPouredUnitsOfSand(rockPaths, source, -1)),
-		Part2: strconv.Itoa(p.countPouredUnitsOfSand(rockPaths, source, 1)),
+		Part1: strconv.Itoa(part1),
+		Part2: strconv.Itoa(part2),
 	}, nil
 }
 
-func (p RegolithReservoir) countPouredUnitsOfSand(paths []rockPath, source point, floorPadding int) int {
-	result := 0
-	cave := p.draw(paths, floorPadding)
+// Render draws the cave once the sand poured into it (without a floor) has
+// come to rest, as in the puzzle description.
+func (p RegolithReservoir) Render(input *Input, w io.Writer) error {
+	rec, err := p.record(input, false)
+	if err != nil {
+		return err
+	}
+	var last [][]tile
+	err = rec.replay(len(rec.grains)+1, func(_ int, grid [][]tile) error {
+		last = grid
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, renderTiles(last))
+	return err
+}
+
+// Animate writes frames of the sand being poured into the cave, with or
+// without a floor: one before the first grain, one every n grains and one
+// once the sand has come to rest. Frames are either text ("text") or images
+// of an animated GIF ("gif").
+func (p RegolithReservoir) Animate(input *Input, withFloor bool, n int, format string, w io.Writer) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid number of grains per frame: %d", n)
+	}
+	if format != "text" && format != "gif" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	rec, err := p.record(input, withFloor)
+	if err != nil {
+		return err
+	}
+
+	if format == "text" {
+		var b strings.Builder
+		err := rec.replay(n, func(grains int, grid [][]tile) error {
+			if grains > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "After %d units of sand:\n%s", grains, renderTiles(grid))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, b.String())
+		return err
+	}
+
+	var anim gif.GIF
+	err = rec.replay(n, func(_ int, grid [][]tile) error {
+		anim.Image = append(anim.Image, paletteTiles(grid))
+		anim.Delay = append(anim.Delay, frameDelay)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	anim.Delay[len(anim.Delay)-1] = lastFrameDelay
+	return gif.EncodeAll(w, &anim)
+}
+
+// sandRecording is a cave along with where each grain of sand poured into it
+// came to rest, in order.
+type sandRecording struct {
+	cave   *cave
+	source point
+	grains []point
+	// min and max are the corners of the box bounding the sand, the source,
+	// the floor under them and the rocks up to cropMargin tiles away.
+	min, max point
+}
+
+const (
+	// cropMargin is how far from the sand and the source rocks are shown,
+	// so that rocks far away from them don't blow up the recording.
+	cropMargin = 2
+	// maxReplayTiles is the largest box of tiles that can be replayed.
+	maxReplayTiles = 1 << 22
+)
+
+func (p RegolithReservoir) record(input *Input, withFloor bool) (*sandRecording, error) {
+	paths, err := p.parse(input)
+	if err != nil {
+		return nil, err
+	}
+	floorPadding := -1
+	if withFloor {
+		floorPadding = 1
+	}
+	c, err := p.draw(paths, floorPadding)
+	if err != nil {
+		return nil, err
+	}
+	rec := &sandRecording{cave: c, source: point{x: 500, y: 0}}
+	if c.hasFloor && rec.source.y >= c.floor {
+		return nil, fmt.Errorf("source %v is not above the floor at y=%d", rec.source, c.floor)
+	}
+
+	rec.min, rec.max = rec.source, rec.source
+	pourer := newSandPourer(c, rec.source)
 	for {
-		if _, ok := cave.pourSand(source); !ok {
+		grain, ok := pourer.pour()
+		if !ok {
 			break
 		}
-		result++
+		rec.grains = append(rec.grains, grain)
+		rec.extend(grain)
+	}
+	windowMin := point{x: rec.min.x - cropMargin, y: rec.min.y - cropMargin}
+	windowMax := point{x: rec.max.x + cropMargin, y: rec.max.y + cropMargin}
+	for pt := range c.tiles {
+		if pt.x >= windowMin.x && pt.x <= windowMax.x && pt.y >= windowMin.y && pt.y <= windowMax.y {
+			rec.extend(pt)
+		}
+	}
+	if c.hasFloor {
+		rec.max.y = c.floor
+	}
+	return rec, nil
+}
+
+func (r *sandRecording) extend(pt point) {
+	if pt.x < r.min.x {
+		r.min.x = pt.x
+	}
+	if pt.y < r.min.y {
+		r.min.y = pt.y
+	}
+	if pt.x > r.max.x {
+		r.max.x = pt.x
+	}
+	if pt.y > r.max.y {
+		r.max.y = pt.y
 	}
-	return result
+}
+
+// replay calls frame with the number of grains of sand poured so far and
+// the tiles within the bounding box: before the first grain, every n
+// grains and after the last one. The tiles are only valid during the call.
+func (r *sandRecording) replay(n int, frame func(grains int, grid [][]tile) error) error {
+	width, height := r.max.x-r.min.x+1, r.max.y-r.min.y+1
+	if width > maxReplayTiles/height {
+		return fmt.Errorf("the sand spans too many tiles to replay: %dx%d", width, height)
+	}
+	grid := make([][]tile, height)
+	for y := range grid {
+		grid[y] = make([]tile, width)
+		for x := range grid[y] {
+			grid[y][x] = air
+			if r.cave.hasFloor && r.min.y+y >= r.cave.floor {
+				grid[y][x] = rock
+			}
+		}
+	}
+	set := func(pt point, t tile) {
+		if pt.x >= r.min.x && pt.x <= r.max.x && pt.y >= r.min.y && pt.y <= r.max.y {
+			grid[pt.y-r.min.y][pt.x-r.min.x] = t
+		}
+	}
+	for pt, t := range r.cave.tiles {
+		if t == rock {
+			set(pt, rock)
+		}
+	}
+	set(r.source, sandSource)
+
+	if err := frame(0, grid); err != nil {
+		return err
+	}
+	for i, grain := range r.grains {
+		set(grain, sand)
+		if (i+1)%n == 0 || i == len(r.grains)-1 {
+			if err := frame(i+1, grid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func renderTiles(grid [][]tile) string {
+	var b strings.Builder
+	for _, row := range grid {
+		for _, t := range row {
+			b.WriteRune(rune(t))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
 }
 
 const (
-	air  tile = '.'
-	rock tile = '#'
-	sand tile = 'o'
+	tileSize       = 3   // in pixels
+	frameDelay     = 4   // in 100ths of a second
+	lastFrameDelay = 300 // in 100ths of a second
+)
+
+var tilePalette = map[tile]uint8{air: 0, rock: 1, sand: 2, sandSource: 3}
+
+var tileColors = color.Palette{
+	color.RGBA{R: 0x1b, G: 0x1b, B: 0x1f, A: 0xff}, // air
+	color.RGBA{R: 0x80, G: 0x80, B: 0x88, A: 0xff}, // rock
+	color.RGBA{R: 0xf2, G: 0xc1, B: 0x4e, A: 0xff}, // sand
+	color.RGBA{R: 0xff, A: 0xff},                   // source
+}
+
+func paletteTiles(grid [][]tile) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, len(grid[0])*tileSize, len(grid)*tileSize), tileColors)
+	for y, row := range grid {
+		for x, t := range row {
+			for py := y * tileSize; py < (y+1)*tileSize; py++ {
+				for px := x * tileSize; px < (x+1)*tileSize; px++ {
+					img.SetColorIndex(px, py, tilePalette[t])
+				}
+			}
+		}
+	}
+	return img
+}
+
+// sandEngine is a way of finding out where the sand poured comes to rest.
+type sandEngine int
+
+const (
+	// stepEngine drops every grain from the source.
+	stepEngine sandEngine = iota
+	// pathEngine resumes every grain from where the previous one was before
+	// coming to rest (see sandPourer).
+	pathEngine
+	// fillEngine fills the cave row by row (see cave.fill), which only
+	// works in caves with a floor.
+	fillEngine
+)
+
+// countPouredUnitsOfSand pours sand until it flows into the abyss or blocks
+// the source. A negative floorPadding means the cave has no floor.
+func (p RegolithReservoir) countPouredUnitsOfSand(paths []rockPath, source point, floorPadding int, engine sandEngine) (int, error) {
+	cave, err := p.draw(paths, floorPadding)
+	if err != nil {
+		return 0, err
+	}
+	if cave.hasFloor && source.y >= cave.floor {
+		return 0, fmt.Errorf("source %v is not above the floor at y=%d", source, cave.floor)
+	}
+
+	switch engine {
+	case stepEngine:
+		result := 0
+		for {
+			if _, ok := cave.pourSand(source); !ok {
+				return result, nil
+			}
+			result++
+		}
+	case pathEngine:
+		result := 0
+		pourer := newSandPourer(cave, source)
+		for {
+			if _, ok := pourer.pour(); !ok {
+				return result, nil
+			}
+			result++
+		}
+	case fillEngine:
+		if !cave.hasFloor {
+			return 0, errors.New("can't fill a cave without a floor")
+		}
+		return cave.fill(source), nil
+	default:
+		return 0, fmt.Errorf("unsupported sand engine: %d", engine)
+	}
+}
+
+const (
+	air        tile = '.'
+	rock       tile = '#'
+	sand       tile = 'o'
+	sandSource tile = '+'
 )
 
 type point struct {
@@ -96,31 +375,30 @@ func (p rockPath) full() rockPath {
 
 type tile rune
 
+// cave is a sparse map of rocks and settled sand, so that paths can be
+// anywhere, including at negative or far apart coordinates.
 type cave struct {
-	tiles    [][]tile
-	abyss    []bool
+	tiles map[point]tile
+	// bottom is the y of the lowest rock. Without a floor, sand falling
+	// past it flows into the abyss.
+	bottom   int
 	hasFloor bool
+	// floor is the y of the floor, which is infinitely wide.
+	floor int
 }
 
 func (c *cave) tile(p point) tile {
-	c.mustBeValid(p)
-
-	if p.y >= len(c.tiles) {
-		if c.hasFloor {
-			return rock
-		}
-		return air
+	if c.hasFloor && p.y >= c.floor {
+		return rock
 	}
-
-	if p.x >= len(c.tiles[p.y]) {
-		return air
+	if t, ok := c.tiles[p]; ok {
+		return t
 	}
-
-	return c.tiles[p.y][p.x]
+	return air
 }
 
 func (c *cave) pourSand(source point) (point, bool) {
-	if c.tile(source) != air || c.leadToAbyss(source) {
+	if c.tile(source) != air {
 		return point{}, false
 	}
 
@@ -128,6 +406,10 @@ func (c *cave) pourSand(source point) (point, bool) {
 
 OUTER:
 	for {
+		if c.leadToAbyss(cur) {
+			return point{}, false
+		}
+
 		candidateMoves := []point{
 			{x: cur.x, y: cur.y + 1},     // down
 			{x: cur.x - 1, y: cur.y + 1}, // down left
@@ -135,45 +417,101 @@ OUTER:
 		}
 
 		for _, move := range candidateMoves {
-			if c.leadToAbyss(move) {
-				break OUTER
-			}
-
 			if c.tile(move) == air {
 				cur = move
 				continue OUTER
 			}
 		}
 
-		if cur.x == len(c.tiles[cur.y]) { // row needs to be expanded
-			c.tiles[cur.y] = append(c.tiles[cur.y], sand)
-		} else {
-			c.tiles[cur.y][cur.x] = sand
-		}
+		c.tiles[cur] = sand
 		return cur, true
 	}
+}
 
-	return point{}, false
+// sandPourer pours sand one grain at a time. Since a grain follows the same
+// path as the previous one up to where that one came to rest, it keeps the
+// path to resume from there rather than dropping every grain from the
+// source.
+type sandPourer struct {
+	cave *cave
+	path []point
 }
 
-func (c *cave) mustBeValid(p point) {
-	if p.x < 0 || p.y < 0 {
-		// Infinite left/up is not supported.
-		panic(fmt.Sprintf("invalid point %v", p))
+func newSandPourer(c *cave, source point) *sandPourer {
+	sp := &sandPourer{cave: c}
+	if c.tile(source) == air {
+		sp.path = []point{source}
 	}
+	return sp
 }
 
-func (c *cave) leadToAbyss(p point) bool {
-	c.mustBeValid(p)
+// pour returns where the next grain comes to rest, if it does.
+func (sp *sandPourer) pour() (point, bool) {
+	c := sp.cave
 
-	if c.hasFloor {
-		return false
+OUTER:
+	for len(sp.path) > 0 {
+		cur := sp.path[len(sp.path)-1]
+		if c.leadToAbyss(cur) {
+			return point{}, false
+		}
+
+		candidateMoves := []point{
+			{x: cur.x, y: cur.y + 1},     // down
+			{x: cur.x - 1, y: cur.y + 1}, // down left
+			{x: cur.x + 1, y: cur.y + 1}, // down right
+		}
+
+		for _, move := range candidateMoves {
+			if c.tile(move) == air {
+				sp.path = append(sp.path, move)
+				continue OUTER
+			}
+		}
+
+		c.tiles[cur] = sand
+		sp.path = sp.path[:len(sp.path)-1]
+		return cur, true
 	}
+	return point{}, false
+}
 
-	return p.y >= len(c.tiles) || p.x >= len(c.abyss) || c.abyss[p.x]
+// fill covers with sand every tile reachable from the source and returns how
+// many there are. In a cave with a floor, that's where the sand poured ends
+// up, since grains keep coming until the source is blocked.
+func (c *cave) fill(source point) int {
+	if c.tile(source) != air {
+		return 0
+	}
+	c.tiles[source] = sand
+	result := 1
+	row := []int{source.x}
+	for y := source.y + 1; y < c.floor && len(row) > 0; y++ {
+		var next []int // sorted, as row is
+		for _, x := range row {
+			for dx := -1; dx <= 1; dx++ {
+				p := point{x + dx, y}
+				if len(next) > 0 && next[len(next)-1] >= p.x {
+					continue
+				}
+				if c.tile(p) == air {
+					c.tiles[p] = sand
+					next = append(next, p.x)
+					result++
+				}
+			}
+		}
+		row = next
+	}
+	return result
 }
 
-var pointRgx = regexp.MustCompile(`^(\d+),(\d+)$`)
+// leadToAbyss tells whether sand at p can only fall forever.
+func (c *cave) leadToAbyss(p point) bool {
+	return !c.hasFloor && p.y >= c.bottom
+}
+
+var pointRgx = regexp.MustCompile(`^(-?\d+),(-?\d+)$`)
 
 func (p RegolithReservoir) parse(input *Input) ([]rockPath, error) {
 	lines := input.Lines()
@@ -181,19 +519,33 @@ func (p RegolithReservoir) parse(input *Input) ([]rockPath, error) {
 
 	for i, line := range lines {
 		var path rockPath
+		offset := 0
+		invalid := func(expected string) error {
+			return &ParseError{
+				Day:      p.Details().Day,
+				Line:     i + 1,
+				Column:   column(line, offset),
+				Text:     line,
+				Expected: expected,
+			}
+		}
 		for j, segment := range strings.Split(line, " -> ") {
 			if !pointRgx.MatchString(segment) {
-				return nil, fmt.Errorf("invalid segment on line %d: %s", i, segment)
+				return nil, invalid("a point such as 498,4")
 			}
 			groups := pointRgx.FindAllStringSubmatch(segment, -1)
-			x, _ := strconv.Atoi(groups[0][1])
-			y, _ := strconv.Atoi(groups[0][2])
+			x, errX := strconv.Atoi(groups[0][1])
+			y, errY := strconv.Atoi(groups[0][2])
+			if errX != nil || errY != nil {
+				return nil, invalid("a point within range")
+			}
 
 			if len(path) > 0 && (path[j-1].x != x && path[j-1].y != y) {
-				return nil, fmt.Errorf("invalid segment on line %d: %s", i, segment)
+				return nil, invalid("a point horizontally or vertically aligned with the previous one")
 			}
 
 			path = append(path, point{x, y})
+			offset += len(segment) + len(" -> ")
 		}
 		result[i] = path
 	}
@@ -201,49 +553,28 @@ func (p RegolithReservoir) parse(input *Input) ([]rockPath, error) {
 	return result, nil
 }
 
-func (p RegolithReservoir) draw(paths []rockPath, floorPadding int) cave {
-	if len(paths) == 0 {
-		return cave{}
-	}
-
-	// Initialise data structures.
-	var rows, cols int
+// draw maps the rocks of the cave. With a non-negative floorPadding, the
+// cave has a floor that many rows below the one after the lowest rock.
+func (p RegolithReservoir) draw(paths []rockPath, floorPadding int) (*cave, error) {
+	c := &cave{tiles: map[point]tile{}, bottom: math.MinInt}
 	for _, path := range paths {
-		for _, point := range path {
-			if point.x >= cols {
-				cols = point.x + 1
-			}
-			if point.y >= rows {
-				rows = point.y + 1
+		for _, point := range path.full() {
+			c.tiles[point] = rock
+			if point.y > c.bottom {
+				c.bottom = point.y
 			}
 		}
 	}
 
-	hasFloor := floorPadding >= 0
-	if hasFloor {
-		rows += floorPadding
-	}
-
-	tiles := make([][]tile, rows)
-	for r := 0; r < rows; r++ {
-		tiles[r] = make([]tile, cols)
-		for c := 0; c < cols; c++ {
-			tiles[r][c] = air
+	if floorPadding >= 0 {
+		if len(c.tiles) == 0 {
+			return nil, errors.New("can't place the floor in a cave without rocks")
 		}
-	}
-
-	abyss := make([]bool, cols)
-	for c := 0; c < cols; c++ {
-		abyss[c] = !hasFloor
-	}
-
-	// Draw rocks and mark off columns that don't lead to the abyss.
-	for _, path := range paths {
-		for _, point := range path.full() {
-			tiles[point.y][point.x] = rock
-			abyss[point.x] = false
+		if c.bottom > math.MaxInt-1-floorPadding {
+			return nil, fmt.Errorf("floor padding %d is out of range", floorPadding)
 		}
+		c.hasFloor = true
+		c.floor = c.bottom + 1 + floorPadding
 	}
-
-	return cave{tiles, abyss, hasFloor}
+	return c, nil
 }
@@ -3,6 +3,10 @@ package adventofcode
 
 import (
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"math"
 	"regexp"
 	"sort"
@@ -23,10 +27,137 @@ func (p BeaconExclusionZone) Solve(input *Input) (Result, error) {
 
 	return Result{
 		Part1: strconv.Itoa(p.countBeaconFreeCells(sensors, 2_000_000)),
-		Part2: strconv.Itoa(p.computeDistressBeaconTuneFrequency(sensors, 4_000_000)),
+		Part2: strconv.Itoa(p.computeDistressBeaconTuneFrequency(sensors, 4_000_000, 4_000_000)),
 	}, nil
 }
 
+func (p BeaconExclusionZone) Render(input *Input, w io.Writer) error {
+	sensors, err := p.parse(input)
+	if err != nil {
+		return err
+	}
+	return p.renderCoverage(sensors, p.viewport(sensors, 4_000_000), 1000, w)
+}
+
+// viewport returns the area spanned by the sensors within the search area from
+// 0,0 to searchSize,searchSize. This shows the whole search area of real
+// inputs while smaller inputs, such as the puzzle example, aren't lost in it.
+func (p BeaconExclusionZone) viewport(sensors []sensor, searchSize int) area {
+	searchArea := area{bottomRight: position{x: searchSize, y: searchSize}}
+	result, found := area{}, false
+	for _, sen := range sensors {
+		if !searchArea.contains(sen.pos) {
+			continue
+		}
+		if !found {
+			result, found = area{topLeft: sen.pos, bottomRight: sen.pos}, true
+			continue
+		}
+		if sen.pos.x < result.topLeft.x {
+			result.topLeft.x = sen.pos.x
+		}
+		if sen.pos.y < result.topLeft.y {
+			result.topLeft.y = sen.pos.y
+		}
+		if sen.pos.x > result.bottomRight.x {
+			result.bottomRight.x = sen.pos.x
+		}
+		if sen.pos.y > result.bottomRight.y {
+			result.bottomRight.y = sen.pos.y
+		}
+	}
+	if !found {
+		return searchArea
+	}
+	return result
+}
+
+var (
+	coverageColors = []color.RGBA{
+		{R: 0x8d, G: 0xd3, B: 0xc7, A: 0xff},
+		{R: 0xff, G: 0xff, B: 0xb3, A: 0xff},
+		{R: 0xbe, G: 0xba, B: 0xda, A: 0xff},
+		{R: 0xfb, G: 0x80, B: 0x72, A: 0xff},
+		{R: 0x80, G: 0xb1, B: 0xd3, A: 0xff},
+		{R: 0xfd, G: 0xb4, B: 0x62, A: 0xff},
+		{R: 0xb3, G: 0xde, B: 0x69, A: 0xff},
+		{R: 0xfc, G: 0xcd, B: 0xe5, A: 0xff},
+	}
+	uncoveredColor      = color.RGBA{A: 0xff}
+	sensorColor         = color.RGBA{B: 0xff, A: 0xff}
+	beaconColor         = color.RGBA{R: 0xff, A: 0xff}
+	distressBeaconColor = color.RGBA{G: 0xff, A: 0xff}
+)
+
+// renderCoverage draws the coverage diamond of each sensor within the
+// viewport as a PNG image whose longest side is maxSize pixels. Areas covered
+// by more than one sensor are darkened.
+func (p BeaconExclusionZone) renderCoverage(sensors []sensor, viewport area, maxSize int, w io.Writer) error {
+	width := viewport.bottomRight.x - viewport.topLeft.x + 1
+	height := viewport.bottomRight.y - viewport.topLeft.y + 1
+	if width <= 0 || height <= 0 || maxSize <= 0 {
+		return fmt.Errorf("invalid viewport: %v", viewport)
+	}
+
+	// scale is the number of positions per pixel, which is below 1 when small
+	// viewports are blown up to fill the image.
+	scale := math.Max(float64(width), float64(height)) / float64(maxSize)
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Round(float64(width)/scale)), int(math.Round(float64(height)/scale))))
+	toPixel := func(pos position) (int, int) {
+		return int(float64(pos.x-viewport.topLeft.x) / scale), int(float64(pos.y-viewport.topLeft.y) / scale)
+	}
+
+	bounds := img.Bounds()
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			pos := position{
+				x: viewport.topLeft.x + int(float64(px)*scale),
+				y: viewport.topLeft.y + int(float64(py)*scale),
+			}
+			first, overlaps := -1, 0
+			for i, sen := range sensors {
+				if sen.pos.distance(pos) <= sen.distanceToBeacon() {
+					if first < 0 {
+						first = i
+					}
+					overlaps++
+				}
+			}
+			if first < 0 {
+				img.SetRGBA(px, py, uncoveredColor)
+				continue
+			}
+			c := coverageColors[first%len(coverageColors)]
+			if overlaps > 1 {
+				c.R, c.G, c.B = c.R/4*3, c.G/4*3, c.B/4*3
+			}
+			img.SetRGBA(px, py, c)
+		}
+	}
+
+	mark := func(pos position, radius int, c color.RGBA) {
+		x0, y0 := toPixel(pos)
+		x1, y1 := toPixel(position{x: pos.x + 1, y: pos.y + 1})
+		if x1 == x0 {
+			x1, y1 = x0+1, y0+1 // several positions per pixel
+		}
+		for y := y0 - radius; y < y1+radius; y++ {
+			for x := x0 - radius; x < x1+radius; x++ {
+				img.SetRGBA(x, y, c) // out of bounds pixels are ignored
+			}
+		}
+	}
+	for _, sen := range sensors {
+		mark(sen.pos, 2, sensorColor)
+		mark(sen.closestBeacon, 2, beaconColor)
+	}
+	if pos, ok := p.findDistressBeacon(sensors, viewport); ok {
+		mark(pos, 4, distressBeaconColor)
+	}
+
+	return png.Encode(w, img)
+}
+
 func (p BeaconExclusionZone) countBeaconFreeCells(sensors []sensor, row int) int {
 	result := 0
 	for _, in := range p.computeRowExclusionIntervals(row, sensors) {
@@ -35,11 +166,12 @@ func (p BeaconExclusionZone) countBeaconFreeCells(sensors []sensor, row int) int
 	return result
 }
 
-// TODO improve running time
-func (p BeaconExclusionZone) computeDistressBeaconTuneFrequency(sensors []sensor, xMultiplier int) int {
+// computeDistressBeaconTuneFrequency looks for the distress beacon in the
+// area from 0,0 to searchSize,searchSize.
+func (p BeaconExclusionZone) computeDistressBeaconTuneFrequency(sensors []sensor, searchSize, xMultiplier int) int {
 	searchArea := area{
 		topLeft:     position{x: 0, y: 0},
-		bottomRight: position{x: xMultiplier, y: xMultiplier},
+		bottomRight: position{x: searchSize, y: searchSize},
 	}
 	if pos, ok := p.findDistressBeacon(sensors, searchArea); ok {
 		return (pos.x * xMultiplier) + pos.y
@@ -47,48 +179,71 @@ func (p BeaconExclusionZone) computeDistressBeaconTuneFrequency(sensors []sensor
 	return -1
 }
 
+// findDistressBeacon relies on the fact that, if there is a single uncovered
+// position in the search area, its neighbours are covered, so it sits right
+// outside the boundary of the sensors covering them. The diagonal lines
+// enclosing each sensor's coverage diamond are described by x+y=a and x-y=b,
+// so the position is either where an "a" line crosses a "b" line, where a
+// line crosses an edge of the area (when the position is on that edge), or
+// in one of the corners of the area.
 func (p BeaconExclusionZone) findDistressBeacon(sensors []sensor, searchArea area) (position, bool) {
-	for row := searchArea.topLeft.y; row <= searchArea.bottomRight.y; row++ {
-		beaconsOnRow := map[int]bool{} // TODO move this outside the loop
-		for _, sen := range sensors {
-			if sen.closestBeacon.y == row {
-				beaconsOnRow[sen.closestBeacon.x] = true
-			}
-		}
-
-		findInGap := func(lo, hi int) (position, bool) {
-			for col := lo; col <= hi; col++ {
-				if _, ok := beaconsOnRow[col]; !ok {
-					return position{x: col, y: row}, true
-				}
-			}
-			return position{}, false
-		}
-
-		exclusions := p.computeRowExclusionIntervals(row, sensors)
-		prev := searchArea.topLeft.x - 1
+	ascending, descending := map[int]bool{}, map[int]bool{}
+	for _, sen := range sensors {
+		radius := sen.distanceToBeacon() + 1
+		ascending[sen.pos.x-sen.pos.y-radius] = true
+		ascending[sen.pos.x-sen.pos.y+radius] = true
+		descending[sen.pos.x+sen.pos.y-radius] = true
+		descending[sen.pos.x+sen.pos.y+radius] = true
+	}
 
-		for _, excl := range exclusions {
-			if excl.end < searchArea.topLeft.x {
-				continue
-			}
-			if excl.start > searchArea.bottomRight.x {
-				break
-			}
-			if pos, ok := findInGap(prev+1, excl.start-1); ok {
-				return pos, true
+	minX, minY := searchArea.topLeft.x, searchArea.topLeft.y
+	maxX, maxY := searchArea.bottomRight.x, searchArea.bottomRight.y
+	candidates := []position{
+		{x: minX, y: minY},
+		{x: maxX, y: minY},
+		{x: minX, y: maxY},
+		{x: maxX, y: maxY},
+	}
+	for a := range descending {
+		candidates = append(candidates,
+			position{x: minX, y: a - minX},
+			position{x: maxX, y: a - maxX},
+			position{x: a - minY, y: minY},
+			position{x: a - maxY, y: maxY},
+		)
+		for b := range ascending {
+			if (a+b)%2 != 0 {
+				continue // lines don't cross on an integer position
 			}
-			prev = excl.end
+			candidates = append(candidates, position{x: (a + b) / 2, y: (a - b) / 2})
 		}
+	}
+	for b := range ascending {
+		candidates = append(candidates,
+			position{x: minX, y: minX - b},
+			position{x: maxX, y: maxX - b},
+			position{x: b + minY, y: minY},
+			position{x: b + maxY, y: maxY},
+		)
+	}
 
-		if pos, ok := findInGap(prev+1, searchArea.bottomRight.x); ok {
+	for _, pos := range candidates {
+		if searchArea.contains(pos) && !p.isCovered(pos, sensors) {
 			return pos, true
 		}
 	}
-
 	return position{}, false
 }
 
+func (p BeaconExclusionZone) isCovered(pos position, sensors []sensor) bool {
+	for _, sen := range sensors {
+		if sen.pos.distance(pos) <= sen.distanceToBeacon() {
+			return true
+		}
+	}
+	return false
+}
+
 func (p BeaconExclusionZone) computeRowExclusionIntervals(row int, sensors []sensor) []interval {
 	intervals := []interval{}
 	beaconsOnRow := map[int]bool{}
@@ -175,6 +330,11 @@ type area struct {
 	topLeft, bottomRight position
 }
 
+func (a area) contains(p position) bool {
+	return p.x >= a.topLeft.x && p.x <= a.bottomRight.x &&
+		p.y >= a.topLeft.y && p.y <= a.bottomRight.y
+}
+
 type sensor struct {
 	pos, closestBeacon position
 }
@@ -203,7 +363,12 @@ func (p BeaconExclusionZone) parse(input *Input) ([]sensor, error) {
 
 	for i, line := range lines {
 		if !sensorRgx.MatchString(line) {
-			return nil, fmt.Errorf("invalid line %d: %s", i, line)
+			return nil, &ParseError{
+				Day:      p.Details().Day,
+				Line:     i + 1,
+				Text:     line,
+				Expected: "a sensor report such as 'Sensor at x=2, y=18: closest beacon is at x=-2, y=15'",
+			}
 		}
 		groups := sensorRgx.FindAllStringSubmatch(line, -1)
 		sx, _ := strconv.Atoi(groups[0][1])